@@ -0,0 +1,51 @@
+package shelflib
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Delay schedule for requests that are retried.
+type Backoff struct {
+	// Total number of attempts, including the first.
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+var DefaultBackoff = &Backoff{Attempts: 5, Initial: 100 * time.Millisecond, Max: 5 * time.Second}
+
+// Waits the Delay after the given attempt, or until ctx is
+// done, in which case the error of ctx is returned.
+func (this *Backoff) Wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(this.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Delay before the attempt after the given one. The delay doubles
+// with every attempt, is capped at Max and has jitter added.
+func (this *Backoff) Delay(attempt int) time.Duration {
+	delay := this.Initial
+
+	for i := 0; i < attempt && delay < this.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > this.Max {
+		delay = this.Max
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,55 @@
+package shelflib
+
+import (
+	"github.com/tomnomnom/linkheader"
+	"io"
+)
+
+// Operations on artifacts and directories of artifacts.
+type ArtifactClient interface {
+	DownloadArtifact(path string) (*io.ReadCloser, *ShelfError)
+	DownloadArtifactToFile(path string, filePath string) *ShelfError
+	ListArtifact(path string) (*linkheader.Links, *ShelfError)
+	UploadArtifact(path string, reader io.Reader) *ShelfError
+	UploadArtifactFromFile(path string, filePath string) *ShelfError
+	UploadArtifactOnce(path string, reader io.Reader, opts *UploadOptions) (bool, *ShelfError)
+	UploadArtifactFromFileOnce(path string, filePath string, opts *UploadOptions) (bool, *ShelfError)
+	CopyArtifact(src string, dst string, opts *CopyOptions) *ShelfError
+	Publish(path string, reader io.Reader, metadata map[string]*MetadataProperty, opts *PublishOptions) *ShelfError
+	UploadDirectory(localDir string, remotePrefix string, opts *UploadDirectoryOptions) (*TransferReport, *ShelfError)
+	DownloadDirectory(remotePrefix string, localDir string, opts *DownloadDirectoryOptions) (*TransferReport, *ShelfError)
+	Walk(prefix string, walk WalkFunc) *ShelfError
+	Sync(localDir string, remotePrefix string, opts *SyncOptions) (*SyncReport, *ShelfError)
+	Mirror(srcPrefix string, dstPrefix string, opts *MirrorOptions) (*MirrorReport, *ShelfError)
+}
+
+// Searching for artifacts by metadata.
+type SearchClient interface {
+	Search(path string, searchCriteria *SearchCriteria) (*linkheader.Links, *ShelfError)
+}
+
+// Operations on the metadata of an artifact.
+type MetadataClient interface {
+	GetMetadata(path string) (map[string]*MetadataProperty, *ShelfError)
+	GetMetadataProperty(path string, propertyKey string) (*MetadataProperty, *ShelfError)
+	GetMetadataInto(path string, v interface{}) *ShelfError
+	UpdateMetadata(path string, metadata map[string]*MetadataProperty) (map[string]*MetadataProperty, *ShelfError)
+	UpdateMetadataFrom(path string, v interface{}) (map[string]*MetadataProperty, *ShelfError)
+	UpdateMetadataProperty(path string, metadata *MetadataProperty) (*MetadataProperty, *ShelfError)
+	UpdateMetadataPropertyIf(path string, name string, expectedValue string, newValue string) (*MetadataProperty, *ShelfError)
+	CreateMetadataProperty(path string, metadata *MetadataProperty) (*MetadataProperty, *ShelfError)
+	DeleteMetadataProperty(path string, propertyKey string) *ShelfError
+	DeleteMetadataProperties(path string, propertyKeys []string) (map[string]*ShelfError, *ShelfError)
+	ApplyMetadata(path string, desired map[string]*MetadataProperty, opts *ApplyMetadataOptions) (*MetadataReport, *ShelfError)
+}
+
+// Everything that can be done with Shelf. Implemented by ShelfLib,
+// and by fakes, caches and other decorators that wrap it.
+type ShelfClient interface {
+	ArtifactClient
+	SearchClient
+	MetadataClient
+}
+
+// Keeps ShelfClient complete.
+var _ ShelfClient = (*ShelfLib)(nil)
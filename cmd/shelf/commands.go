@@ -0,0 +1,223 @@
+package main
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"io"
+	"os"
+	"path"
+	"strconv"
+)
+
+func (this *command) ls() *shelflib.ShelfError {
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	links, shelfErr := this.shelf.ListArtifact(artifactUrl)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	return this.output.links(this.metadataShelf(), artifactUrl, *links)
+}
+
+// ShelfLib to fetch metadata for listed artifacts with, if --metadata was given.
+func (this *command) metadataShelf() *shelflib.ShelfLib {
+	if this.is("--metadata") {
+		return this.shelf
+	}
+
+	return nil
+}
+
+func (this *command) get() *shelflib.ShelfError {
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	filePath := this.argument("<file>")
+
+	if filePath == "" {
+		filePath = path.Base(this.argument("<path>"))
+	}
+
+	if filePath != "-" {
+		return this.shelf.DownloadArtifactToFile(artifactUrl, filePath)
+	}
+
+	body, shelfErr := this.shelf.DownloadArtifact(artifactUrl)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	defer (*body).Close()
+
+	if _, err := io.Copy(this.output.writer, *body); err != nil {
+		return shelflib.CreateShelfErrorFromError(err)
+	}
+
+	return nil
+}
+
+func (this *command) put() *shelflib.ShelfError {
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	filePath := this.argument("<file>")
+	skipIdentical := this.is("--skip-identical")
+	opts := &shelflib.UploadOptions{Preflight: true}
+
+	if filePath == "-" {
+		if skipIdentical {
+			_, shelfErr = this.shelf.UploadArtifactOnce(artifactUrl, this.stdin, opts)
+
+			return shelfErr
+		}
+
+		return this.shelf.UploadArtifact(artifactUrl, this.stdin)
+	}
+
+	// Checked first so that a missing file is not
+	// reported as a failure to talk to Shelf.
+	if _, err := os.Stat(filePath); err != nil {
+		return usageError(err.Error())
+	}
+
+	if skipIdentical {
+		_, shelfErr = this.shelf.UploadArtifactFromFileOnce(artifactUrl, filePath, opts)
+
+		return shelfErr
+	}
+
+	return this.shelf.UploadArtifactFromFile(artifactUrl, filePath)
+}
+
+func (this *command) search() *shelflib.ShelfError {
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	criteria := &shelflib.SearchCriteria{}
+	criteria.Search, _ = this.arguments["--search"].([]string)
+	criteria.Sort, _ = this.arguments["--sort"].([]string)
+
+	if limit := this.argument("--limit"); limit != "" {
+		var err error
+
+		criteria.Limit, err = strconv.Atoi(limit)
+
+		if err != nil || criteria.Limit < 0 {
+			return usageError("Invalid --limit " + limit + ".")
+		}
+	}
+
+	links, shelfErr := this.shelf.Search(artifactUrl, criteria)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	return this.output.links(this.metadataShelf(), artifactUrl, *links)
+}
+
+func (this *command) metaGet() *shelflib.ShelfError {
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	// A list because meta rm takes several names.
+	names, _ := this.arguments["<name>"].([]string)
+
+	if len(names) == 0 {
+		metadata, shelfErr := this.shelf.GetMetadata(artifactUrl)
+
+		if shelfErr != nil {
+			return shelfErr
+		}
+
+		return this.output.properties(metadata)
+	}
+
+	prop, shelfErr := this.shelf.GetMetadataProperty(artifactUrl, names[0])
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	return this.output.property(prop)
+}
+
+// Sets a property, or only creates it when create is true.
+func (this *command) metaSet(create bool) *shelflib.ShelfError {
+	var prop *shelflib.MetadataProperty
+
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	names, _ := this.arguments["<name>"].([]string)
+	value := this.argument("<value>")
+	desired := shelflib.CreateMetadataProperty(names[0], value, this.is("--immutable"))
+
+	if create {
+		prop, shelfErr = this.shelf.CreateMetadataProperty(artifactUrl, desired)
+	} else {
+		prop, shelfErr = this.shelf.UpdateMetadataProperty(artifactUrl, desired)
+	}
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	return this.output.property(prop)
+}
+
+// Removes properties. Every failure is reported and the
+// first one decides the exit code.
+func (this *command) metaRm() *shelflib.ShelfError {
+	var first *shelflib.ShelfError
+
+	artifactUrl, shelfErr := this.url()
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	names, _ := this.arguments["<name>"].([]string)
+	failures, shelfErr := this.shelf.DeleteMetadataProperties(artifactUrl, names)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	for _, name := range names {
+		if failure, ok := failures[name]; ok {
+			io.WriteString(this.stderr, "shelf: "+name+": "+failure.Message+"\n")
+
+			if first == nil {
+				first = failure
+			}
+		}
+	}
+
+	if first != nil {
+		return shelflib.CreateShelfError(strconv.Itoa(len(failures))+" of "+strconv.Itoa(len(names))+" properties were not removed.", first.Code)
+	}
+
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"github.com/not-nexus/shelf-lib-go"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hidden command the completion scripts run. It is given the words
+// after "shelf" up to and including the word being completed.
+const completeCommand = "__complete"
+
+// How long listings and metadata names are cached for completion.
+var completionCacheTtl = 30 * time.Second
+
+var commands = []string{"ls", "get", "put", "search", "meta", "completion"}
+var metaCommands = []string{"get", "set", "create", "rm"}
+var shells = []string{"bash", "zsh", "fish"}
+
+// Options that take a value, so that their values are
+// not mistaken for arguments.
+var valueOptions = []string{"--host", "--bucket", "--token", "--profile", "-o", "--output", "--template", "--search", "--sort", "--limit"}
+var flagOptions = []string{"-h", "--help", "--version", "-v", "--verbose", "--metadata", "--immutable", "--skip-identical"}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for shelf. Load with:
+#     source <(shelf completion bash)
+_shelf() {
+    local IFS=$'\n'
+    COMPREPLY=($(shelf __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+
+    # Directories are completed further, so no space after them.
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+complete -o default -F _shelf shelf
+`,
+	"zsh": `#compdef shelf
+# zsh completion for shelf. Load with:
+#     source <(shelf completion zsh)
+_shelf() {
+    local -a candidates directories others
+    candidates=("${(@f)$(shelf __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+
+    if (( ${#candidates} == 0 )); then
+        _files
+        return
+    fi
+
+    directories=(${(M)candidates:#*/})
+    others=(${candidates:#*/})
+    compadd -S '' -a directories
+    compadd -a others
+}
+compdef _shelf shelf
+`,
+	"fish": `# fish completion for shelf. Load with:
+#     shelf completion fish | source
+function __shelf_complete
+    set -l words (commandline -opc)[2..-1] (commandline -ct)
+    shelf __complete $words 2>/dev/null
+end
+complete -c shelf -a '(__shelf_complete)'
+`,
+}
+
+// Prints the completion script for a shell.
+func completion(shell string, stdout io.Writer) *shelflib.ShelfError {
+	script, ok := completionScripts[shell]
+
+	if !ok {
+		return usageError("Unknown shell " + shell + ", expected one of " + strings.Join(shells, ", ") + ".")
+	}
+
+	_, err := io.WriteString(stdout, script)
+
+	if err != nil {
+		return shelflib.CreateShelfErrorFromError(err)
+	}
+
+	return nil
+}
+
+// Prints the candidates for the last of words, one per line.
+// Failures print nothing so that the shell falls back to files.
+func complete(words []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+	arguments := docopt.Opts{"--output": shelflib.FormatTable}
+	positional := make([]string, 0)
+
+	for i := 0; i < len(words)-1; i++ {
+		word := words[i]
+
+		if contains(valueOptions, word) {
+			if i+1 < len(words)-1 {
+				arguments[word] = words[i+1]
+			}
+
+			i++
+		} else if !strings.HasPrefix(word, "-") {
+			positional = append(positional, word)
+		}
+	}
+
+	previous := ""
+
+	if len(words) > 1 {
+		previous = words[len(words)-2]
+	}
+
+	var candidates []string
+
+	switch {
+	case previous == "-o" || previous == "--output":
+		candidates = shelflib.Formats
+	case contains(valueOptions, previous):
+		candidates = nil
+	case strings.HasPrefix(current, "-"):
+		candidates = append(append([]string{}, valueOptions...), flagOptions...)
+	default:
+		candidates = completeArgument(positional, current, func() *command {
+			// Output is discarded; only the ShelfLib and config are used.
+			command, shelfErr := newCommand(arguments, stdin, ioutil.Discard, stderr)
+
+			if shelfErr != nil {
+				return nil
+			}
+
+			return command
+		})
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Fprintln(stdout, candidate)
+		}
+	}
+
+	return exitOk
+}
+
+// Candidates for the argument after positional. newCommand is
+// only called when Shelf has to be asked.
+func completeArgument(positional []string, current string, newCommand func() *command) []string {
+	if len(positional) == 0 {
+		return commands
+	}
+
+	remote := func(complete func(*command) []string) []string {
+		if command := newCommand(); command != nil {
+			return complete(command)
+		}
+
+		return nil
+	}
+
+	switch positional[0] {
+	case "completion":
+		if len(positional) == 1 {
+			return shells
+		}
+	case "ls", "get", "search":
+		if len(positional) == 1 {
+			return remote(func(command *command) []string { return command.completePath(current) })
+		}
+	case "put":
+		if len(positional) == 2 {
+			return remote(func(command *command) []string { return command.completePath(current) })
+		}
+	case "meta":
+		if len(positional) == 1 {
+			return metaCommands
+		}
+
+		if len(positional) == 2 {
+			return remote(func(command *command) []string { return command.completePath(current) })
+		}
+
+		if len(positional) == 3 || positional[1] == "rm" {
+			return remote(func(command *command) []string {
+				return without(command.completeNames(positional[2]), positional[3:])
+			})
+		}
+	}
+
+	return nil
+}
+
+// Paths in the directory current is in. Only bucket
+// relative paths are completed, not full URLs.
+func (this *command) completePath(current string) []string {
+	if strings.Contains(current, "://") || this.config.Host == "" || this.config.Bucket == "" {
+		return nil
+	}
+
+	directory := current[:strings.LastIndex(current, "/")+1]
+	directoryUrl := this.config.ArtifactUrl(directory)
+
+	return this.cached("ls "+directoryUrl, func() ([]string, *shelflib.ShelfError) {
+		links, shelfErr := this.shelf.ListArtifact(directoryUrl)
+
+		if shelfErr != nil {
+			return nil, shelfErr
+		}
+
+		records, shelfErr := shelflib.NewArtifactRecords(directoryUrl, *links)
+
+		if shelfErr != nil {
+			return nil, shelfErr
+		}
+
+		paths := make([]string, 0, len(records))
+
+		for _, record := range records {
+			if record.Rel == "item" {
+				paths = append(paths, record.Path)
+			}
+		}
+
+		return paths, nil
+	})
+}
+
+// Names of the metadata properties of an artifact.
+func (this *command) completeNames(artifactPath string) []string {
+	if !strings.Contains(artifactPath, "://") && (this.config.Host == "" || this.config.Bucket == "") {
+		return nil
+	}
+
+	artifactUrl := artifactPath
+
+	if !strings.Contains(artifactPath, "://") {
+		artifactUrl = this.config.ArtifactUrl(artifactPath)
+	}
+
+	return this.cached("meta "+artifactUrl, func() ([]string, *shelflib.ShelfError) {
+		metadata, shelfErr := this.shelf.GetMetadata(artifactUrl)
+
+		if shelfErr != nil {
+			return nil, shelfErr
+		}
+
+		names := make([]string, 0, len(metadata))
+
+		for name := range metadata {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return names, nil
+	})
+}
+
+// Candidates for key from the cache if they are recent enough,
+// otherwise from fetch. The token is part of the key because
+// tokens may see different artifacts.
+func (this *command) cached(key string, fetch func() ([]string, *shelflib.ShelfError)) []string {
+	hash := sha256.Sum256([]byte(this.config.Token + "\x00" + key))
+	cachePath := ""
+
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		cachePath = filepath.Join(cacheDir, "shelf", "completion", hex.EncodeToString(hash[:]))
+	}
+
+	if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < completionCacheTtl {
+		if data, err := ioutil.ReadFile(cachePath); err == nil {
+			return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		}
+	}
+
+	candidates, shelfErr := fetch()
+
+	if shelfErr != nil || cachePath == "" || len(candidates) == 0 {
+		return candidates
+	}
+
+	// Written to a temporary file first so that concurrent
+	// completions never read a partial file.
+	if os.MkdirAll(filepath.Dir(cachePath), 0700) == nil {
+		temp := fmt.Sprintf("%s.%d.tmp", cachePath, os.Getpid())
+
+		if ioutil.WriteFile(temp, []byte(strings.Join(candidates, "\n")+"\n"), 0600) == nil {
+			os.Rename(temp, cachePath)
+		}
+	}
+
+	return candidates
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Values that are not in exclude.
+func without(values []string, exclude []string) []string {
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if !contains(exclude, value) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("completion", func() {
+	var (
+		server *shelftest.Server
+		dir    string
+		stdout *bytes.Buffer
+	)
+
+	// Candidates for the last word, with the connection options first.
+	complete := func(words ...string) string {
+		stdout.Reset()
+		args := append([]string{completeCommand, "--host", server.URL, "--bucket", "test", "--token", "VALIDTOKEN"}, words...)
+		Expect(run(args, &bytes.Buffer{}, stdout, &bytes.Buffer{})).To(Equal(exitOk))
+
+		return stdout.String()
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "shelf")
+		Expect(err).ShouldNot(HaveOccurred())
+		os.Setenv(shelflib.ConfigEnvVar, filepath.Join(dir, "config.yaml"))
+		os.Setenv(shelflib.CredentialsEnvVar, filepath.Join(dir, "credentials"))
+		os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+		server = shelftest.NewServer("VALIDTOKEN")
+		server.PutArtifact("test", "dir/thing", []byte("contents"))
+		server.PutArtifact("test", "dir/sub/other", []byte("contents"))
+		server.PutArtifact("test", "top", []byte("contents"))
+		server.SetMetadata("test", "dir/thing", shelflib.CreateMetadataProperty("version", "1", false))
+		stdout = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+		os.Unsetenv(shelflib.ConfigEnvVar)
+		os.Unsetenv(shelflib.CredentialsEnvVar)
+		os.Unsetenv("XDG_CACHE_HOME")
+	})
+
+	It("should complete commands and option values", func() {
+		Expect(complete("")).To(Equal("ls\nget\nput\nsearch\nmeta\ncompletion\n"))
+		Expect(complete("meta", "c")).To(Equal("create\n"))
+		Expect(complete("ls", "--output", "j")).To(Equal("json\njsonl\n"))
+		Expect(complete("ls", "--imm")).To(Equal("--immutable\n"))
+		Expect(complete("put", "--skip")).To(Equal("--skip-identical\n"))
+		Expect(complete("completion", "")).To(Equal("bash\nzsh\nfish\n"))
+	})
+
+	It("should complete artifact paths from the parent directory", func() {
+		Expect(complete("ls", "")).To(Equal("dir/\ntop\n"))
+		Expect(complete("get", "dir/s")).To(Equal("dir/sub/\n"))
+		Expect(complete("put", "local", "dir/")).To(Equal("dir/sub/\ndir/thing\n"))
+		Expect(complete("put", "")).To(BeEmpty())
+		Expect(complete("ls", "https://elsewhere/")).To(BeEmpty())
+	})
+
+	It("should complete metadata property names", func() {
+		Expect(complete("meta", "get", "dir/thing", "v")).To(Equal("version\n"))
+		Expect(complete("meta", "rm", "dir/thing", "version", "a")).To(Equal("artifactName\nartifactPath\n"))
+		Expect(complete("meta", "rm", "dir/thing", "version", "v")).To(BeEmpty())
+		Expect(complete("meta", "set", "dir/thing", "version", "")).To(BeEmpty())
+	})
+
+	It("should cache results briefly", func() {
+		Expect(complete("ls", "dir/")).To(Equal("dir/sub/\ndir/thing\n"))
+		server.PutArtifact("test", "dir/new", []byte("contents"))
+		server.ResetRequests()
+
+		Expect(complete("ls", "dir/")).To(Equal("dir/sub/\ndir/thing\n"))
+		Expect(server.Requests()).To(BeEmpty())
+
+		defer func(ttl time.Duration) { completionCacheTtl = ttl }(completionCacheTtl)
+		completionCacheTtl = 0
+		Expect(complete("ls", "dir/")).To(ContainSubstring("dir/new\n"))
+	})
+
+	It("should complete nothing when Shelf fails", func() {
+		stdout.Reset()
+		Expect(run([]string{completeCommand, "--host", server.URL, "--bucket", "test", "--token", "WRONG", "ls", ""}, &bytes.Buffer{}, stdout, &bytes.Buffer{})).To(Equal(exitOk))
+		Expect(stdout.String()).To(Equal(""))
+	})
+
+	It("should print completion scripts", func() {
+		Expect(run([]string{"completion", "bash"}, &bytes.Buffer{}, stdout, &bytes.Buffer{})).To(Equal(exitOk))
+		Expect(stdout.String()).To(ContainSubstring("complete -o default -F _shelf shelf"))
+		Expect(run([]string{"completion", "tcsh"}, &bytes.Buffer{}, stdout, &bytes.Buffer{})).To(Equal(exitUsage))
+	})
+
+	It("should print completion scripts with a broken config", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("host: [unclosed"), 0644)).To(Succeed())
+		Expect(run([]string{"ls", "dir"}, &bytes.Buffer{}, stdout, &bytes.Buffer{})).ShouldNot(Equal(exitOk))
+		Expect(run([]string{"completion", "zsh"}, &bytes.Buffer{}, stdout, &bytes.Buffer{})).To(Equal(exitOk))
+		Expect(stdout.String()).To(HavePrefix("#compdef shelf"))
+	})
+})
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+)
+
+// Exit codes, as documented in the usage.
+const (
+	exitOk               = 0
+	exitFailure          = 1
+	exitUsage            = 2
+	exitNotFound         = 3
+	exitPermissionDenied = 4
+	exitForbidden        = 5
+	exitConflict         = 6
+	exitInvalid          = 7
+	exitUnavailable      = 8
+)
+
+// Code of errors caused by invalid usage.
+const codeUsage = "usage"
+
+// Exit code for each ShelfError code. Codes
+// that are not listed exit with exitFailure.
+var exitCodes = map[string]int{
+	codeUsage:                               exitUsage,
+	shelflib.CodeResourceNotFound:           exitNotFound,
+	shelflib.CodeMissingMetadataProperty:    exitNotFound,
+	shelflib.CodeUnauthorized:               exitPermissionDenied,
+	shelflib.CodePermissionDenied:           exitPermissionDenied,
+	shelflib.CodeForbidden:                  exitPermissionDenied,
+	shelflib.CodeForbiddenImmutableProperty: exitForbidden,
+	shelflib.CodeContentMismatch:            exitForbidden,
+	shelflib.CodeDuplicateArtifact:          exitForbidden,
+	shelflib.CodeConflict:                   exitConflict,
+	shelflib.CodePreconditionFailed:         exitConflict,
+	shelflib.CodeBadRequest:                 exitInvalid,
+	shelflib.CodeInvalidRequestDataFormat:   exitInvalid,
+	shelflib.CodeInvalidArtifactName:        exitInvalid,
+	shelflib.CodeInvalidSearchCriteria:      exitInvalid,
+	shelflib.CodeMethodNotAllowed:           exitInvalid,
+	shelflib.CodeTooManyRequests:            exitUnavailable,
+	shelflib.CodeInternalServerError:        exitUnavailable,
+	shelflib.CodeBadGateway:                 exitUnavailable,
+	shelflib.CodeServiceUnavailable:         exitUnavailable,
+	shelflib.CodeGatewayTimeout:             exitUnavailable,
+	shelflib.CodeNetworkError:               exitUnavailable,
+}
+
+func exitCode(shelfErr *shelflib.ShelfError) int {
+	code := shelfErr.Code
+
+	// Errors from sending the request have no code.
+	if code == "" && shelflib.IsRetryable(shelfErr) {
+		code = shelflib.CodeNetworkError
+	}
+
+	if exit, ok := exitCodes[code]; ok {
+		return exit
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,256 @@
+// Command shelf interacts with Shelf from the command line.
+//
+// Build a static binary with:
+//
+//	CGO_ENABLED=0 go build -o shelf ./cmd/shelf
+package main
+
+import (
+	"fmt"
+	"github.com/docopt/docopt-go"
+	"github.com/not-nexus/shelf-lib-go"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const version = "shelf 1.0.0"
+
+const usage = `shelf
+
+    Command line interface for Shelf.
+
+    Usage:
+        shelf ls <path> [options]
+        shelf get <path> [<file>] [options]
+        shelf put <file> <path> [--skip-identical] [options]
+        shelf search <path> [--search <criteria>]... [--sort <key>]... [--limit <n>] [options]
+        shelf meta get <path> [<name>] [options]
+        shelf meta set <path> <name> <value> [--immutable] [options]
+        shelf meta create <path> <name> <value> [--immutable] [options]
+        shelf meta rm <path> <name>... [options]
+        shelf completion <shell>
+        shelf -h | --help
+        shelf --version
+
+    Commands:
+        ls                      List an artifact, or the contents of a directory.
+        get                     Download an artifact to <file>, or to stdout
+                                if <file> is "-". <file> defaults to the
+                                name of the artifact.
+        put                     Upload <file>, or stdin if <file> is "-".
+        search                  Search for artifacts under <path>.
+        meta get                Show all metadata of an artifact, or one property.
+        meta set                Create or update a metadata property.
+        meta create             Create a metadata property that does not exist.
+        meta rm                 Remove metadata properties.
+        completion              Print the completion script for <shell>,
+                                bash, zsh or fish. Artifact paths and
+                                property names are completed from Shelf
+                                and cached for 30 seconds.
+
+    Options:
+        -h --help               Show this message.
+        --version               Show the version.
+        -v --verbose            Log every request.
+        --host <host>           Shelf host. Defaults to SHELF_HOST or the
+                                config file.
+        --bucket <bucket>       Bucket to use. Defaults to SHELF_BUCKET or
+                                the config file.
+        --token <token>         Shelf token. Defaults to SHELF_AUTH_TOKEN,
+                                SHELF_TOKEN_FILE, the config file or the
+                                credentials file.
+        --profile <profile>     Profile of the config file to use.
+        -o --output <format>    Output format: json, jsonl, csv, table or
+                                template [default: table].
+        --template <template>   Go template executed for each artifact or
+                                property, such as "{{.Path}} {{.Url}}".
+                                Implies --output template.
+        --metadata              Include the metadata of each artifact
+                                listed by ls and search.
+        --search <criteria>     Search criteria such as "version=1.*".
+        --sort <key>            Sort key such as "version, DESC, VERSION".
+        --limit <n>             Return at most n artifacts.
+        --immutable             Make the property immutable.
+        --skip-identical        Succeed without uploading if the artifact
+                                exists with the same content.
+
+    Arguments:
+        <path>                  Artifact path in the bucket, or a full URL.
+
+    Exit codes:
+        0                       Success.
+        1                       Any other failure.
+        2                       Invalid usage.
+        3                       Artifact or property not found.
+        4                       Token missing, invalid or not permitted.
+        5                       Immutable property or duplicate artifact.
+        6                       Changed by another client.
+        7                       Request rejected as invalid by Shelf.
+        8                       Shelf unavailable or unreachable.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Runs the command line given by args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == completeCommand {
+		return complete(args[1:], stdin, stdout, stderr)
+	}
+
+	exit := -1
+	parser := &docopt.Parser{HelpHandler: func(err error, help string) {
+		if err != nil {
+			fmt.Fprintln(stderr, help)
+			exit = exitUsage
+		} else {
+			fmt.Fprintln(stdout, help)
+			exit = exitOk
+		}
+	}}
+
+	arguments, err := parser.ParseArgs(usage, args, version)
+
+	if exit >= 0 {
+		return exit
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "shelf: "+err.Error())
+
+		return exitUsage
+	}
+
+	var shelfErr *shelflib.ShelfError
+
+	// Needs no config, so that a broken one cannot stop the script.
+	if isCompletion, _ := arguments.Bool("completion"); isCompletion {
+		shell, _ := arguments.String("<shell>")
+		shelfErr = completion(shell, stdout)
+	} else {
+		var command *command
+
+		command, shelfErr = newCommand(arguments, stdin, stdout, stderr)
+
+		if shelfErr == nil {
+			shelfErr = command.run()
+		}
+	}
+
+	if shelfErr != nil {
+		fmt.Fprintln(stderr, "shelf: "+shelfErr.Message)
+
+		return exitCode(shelfErr)
+	}
+
+	return exitOk
+}
+
+// Everything a subcommand needs.
+type command struct {
+	arguments docopt.Opts
+	config    *shelflib.Config
+	shelf     *shelflib.ShelfLib
+	output    *output
+	stdin     io.Reader
+	stderr    io.Writer
+}
+
+func newCommand(arguments docopt.Opts, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*command, *shelflib.ShelfError) {
+	overrides := &shelflib.Config{}
+	overrides.Host, _ = arguments.String("--host")
+	overrides.Bucket, _ = arguments.String("--bucket")
+	overrides.Token, _ = arguments.String("--token")
+	overrides.Profile, _ = arguments.String("--profile")
+
+	config, shelfErr := shelflib.LoadConfig(overrides)
+
+	if shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	format, _ := arguments.String("--output")
+	template, _ := arguments.String("--template")
+	out, shelfErr := newOutput(format, template, stdout)
+
+	if shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	shelf := shelflib.NewFromConfig(config, log.New(stderr, "", 0))
+
+	// Failures are reported once, by run, unless asked for more.
+	if verbose, _ := arguments.Bool("--verbose"); verbose {
+		shelf.LogLevel.Set(slog.LevelInfo)
+	} else {
+		shelf.SetLogger(slog.New(slog.DiscardHandler))
+	}
+
+	shelf.Use(shelflib.UserAgent(strings.Replace(version, " ", "/", 1)))
+
+	return &command{arguments: arguments, config: config, shelf: shelf, output: out, stdin: stdin, stderr: stderr}, nil
+}
+
+func (this *command) run() *shelflib.ShelfError {
+	switch {
+	case this.is("meta") && this.is("get"):
+		return this.metaGet()
+	case this.is("meta") && this.is("set"):
+		return this.metaSet(false)
+	case this.is("meta") && this.is("create"):
+		return this.metaSet(true)
+	case this.is("meta") && this.is("rm"):
+		return this.metaRm()
+	case this.is("ls"):
+		return this.ls()
+	case this.is("get"):
+		return this.get()
+	case this.is("put"):
+		return this.put()
+	case this.is("search"):
+		return this.search()
+	}
+
+	return usageError("Unknown command.")
+}
+
+func (this *command) is(name string) bool {
+	value, _ := this.arguments.Bool(name)
+
+	return value
+}
+
+func (this *command) argument(name string) string {
+	value, _ := this.arguments.String(name)
+
+	return value
+}
+
+// URL of the <path> argument. Full URLs are used as they are.
+func (this *command) url() (string, *shelflib.ShelfError) {
+	path := this.argument("<path>")
+
+	if strings.Contains(path, "://") {
+		return path, nil
+	}
+
+	if this.config.Host == "" {
+		return "", usageError("No host given with --host, " + shelflib.HostEnvVar + " or the config file.")
+	}
+
+	if this.config.Bucket == "" {
+		return "", usageError("No bucket given with --bucket, " + shelflib.BucketEnvVar + " or the config file.")
+	}
+
+	return this.config.ArtifactUrl(path), nil
+}
+
+// Error for invalid usage. Has no Shelf code, so it
+// is given its own exit code.
+func usageError(message string) *shelflib.ShelfError {
+	return shelflib.CreateShelfError(message, codeUsage)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("shelf", func() {
+	var (
+		server *shelftest.Server
+		dir    string
+		stdin  *bytes.Buffer
+		stdout *bytes.Buffer
+		stderr *bytes.Buffer
+	)
+
+	shelf := func(args ...string) int {
+		stdout.Reset()
+		stderr.Reset()
+		args = append(args, "--host", server.URL, "--bucket", "test", "--token", "VALIDTOKEN")
+
+		return run(args, stdin, stdout, stderr)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "shelf")
+		Expect(err).ShouldNot(HaveOccurred())
+		os.Setenv(shelflib.ConfigEnvVar, filepath.Join(dir, "config.yaml"))
+		os.Setenv(shelflib.CredentialsEnvVar, filepath.Join(dir, "credentials"))
+
+		server = shelftest.NewServer("VALIDTOKEN")
+		server.PutArtifact("test", "dir/thing", []byte("contents"))
+		server.SetMetadata("test", "dir/thing", shelflib.CreateMetadataProperty("version", "1", false))
+		stdin = &bytes.Buffer{}
+		stdout = &bytes.Buffer{}
+		stderr = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+		os.Unsetenv(shelflib.ConfigEnvVar)
+		os.Unsetenv(shelflib.CredentialsEnvVar)
+	})
+
+	It("should list a directory", func() {
+		Expect(shelf("ls", "dir/")).To(Equal(exitOk))
+		Expect(stdout.String()).To(Equal("PATH       TITLE\ndir/thing  artifact\n"))
+	})
+
+	It("should list as JSON", func() {
+		var items []map[string]string
+
+		Expect(shelf("ls", "dir/", "--output", "json")).To(Equal(exitOk))
+		Expect(json.Unmarshal(stdout.Bytes(), &items)).To(Succeed())
+		Expect(items).To(Equal([]map[string]string{{
+			"path":  "dir/thing",
+			"url":   server.URL + "/test/artifact/dir/thing",
+			"rel":   "item",
+			"title": "artifact",
+		}}))
+	})
+
+	It("should list with metadata as CSV or a template", func() {
+		Expect(shelf("ls", "dir/", "--metadata", "--output", "csv")).To(Equal(exitOk))
+		Expect(strings.Split(stdout.String(), "\n")[0]).To(Equal("path,url,title,artifactName,artifactPath,createdDate,md5Hash,sha256Hash,version"))
+
+		Expect(shelf("search", "dir", "--metadata", "--template", `{{.Path}}={{(index .Metadata "version").Value}}`)).To(Equal(exitOk))
+		Expect(stdout.String()).To(Equal("dir/thing=1\n"))
+	})
+
+	It("should download to a file or stdout", func() {
+		filePath := filepath.Join(dir, "downloaded")
+		Expect(shelf("get", "dir/thing", filePath)).To(Equal(exitOk))
+		Expect(ioutil.ReadFile(filePath)).To(Equal([]byte("contents")))
+
+		Expect(shelf("get", "dir/thing", "-")).To(Equal(exitOk))
+		Expect(stdout.String()).To(Equal("contents"))
+	})
+
+	It("should upload a file or stdin", func() {
+		filePath := filepath.Join(dir, "upload")
+		Expect(ioutil.WriteFile(filePath, []byte("from file"), 0644)).To(Succeed())
+		Expect(shelf("put", filePath, "dir/a")).To(Equal(exitOk))
+
+		stdin.WriteString("from stdin")
+		Expect(shelf("put", "-", "dir/b")).To(Equal(exitOk))
+
+		content, _, _ := server.Artifact("test", "dir/a")
+		Expect(string(content)).To(Equal("from file"))
+		content, _, _ = server.Artifact("test", "dir/b")
+		Expect(string(content)).To(Equal("from stdin"))
+	})
+
+	It("should skip identical uploads when asked", func() {
+		stdin.WriteString("contents")
+		Expect(shelf("put", "-", "dir/thing")).To(Equal(exitForbidden))
+
+		stdin.WriteString("contents")
+		Expect(shelf("put", "-", "dir/thing", "--skip-identical")).To(Equal(exitOk))
+
+		stdin.WriteString("changed")
+		Expect(shelf("put", "-", "dir/thing", "--skip-identical")).To(Equal(exitForbidden))
+		Expect(stderr.String()).To(ContainSubstring("exists with sha256"))
+	})
+
+	It("should search", func() {
+		server.PutArtifact("test", "dir/other", []byte("other"))
+		Expect(shelf("search", "dir", "--search", "version=1", "--limit", "5")).To(Equal(exitOk))
+		Expect(stdout.String()).To(ContainSubstring("dir/thing"))
+		Expect(stdout.String()).ShouldNot(ContainSubstring("dir/other"))
+	})
+
+	It("should show metadata", func() {
+		Expect(shelf("meta", "get", "dir/thing", "version")).To(Equal(exitOk))
+		Expect(stdout.String()).To(Equal("NAME     VALUE  IMMUTABLE\nversion  1      false\n"))
+
+		Expect(shelf("meta", "get", "dir/thing", "-o", "json")).To(Equal(exitOk))
+		Expect(stdout.String()).To(ContainSubstring(`"name": "md5Hash"`))
+	})
+
+	It("should set, create and remove metadata", func() {
+		Expect(shelf("meta", "set", "dir/thing", "version", "2")).To(Equal(exitOk))
+		Expect(shelf("meta", "create", "dir/thing", "build", "7", "--immutable")).To(Equal(exitOk))
+		Expect(shelf("meta", "rm", "dir/thing", "version")).To(Equal(exitOk))
+
+		_, metadata, _ := server.Artifact("test", "dir/thing")
+		Expect(metadata).ShouldNot(HaveKey("version"))
+		Expect(metadata["build"]).To(Equal(shelflib.CreateMetadataProperty("build", "7", true)))
+	})
+
+	It("should exit with the code for the Shelf error", func() {
+		Expect(shelf("get", "missing", "-")).To(Equal(exitNotFound))
+		Expect(stderr.String()).To(Equal("shelf: Resource not found\n"))
+
+		Expect(shelf("meta", "rm", "dir/thing", "md5Hash", "missing")).To(Equal(exitForbidden))
+		Expect(stderr.String()).To(ContainSubstring("md5Hash: Metadata property md5Hash is immutable."))
+
+		Expect(shelf("put", "-", "dir/thing")).To(Equal(exitForbidden))
+		Expect(run([]string{"ls", "dir/", "--host", server.URL, "--bucket", "test", "--token", "WRONG"}, stdin, stdout, stderr)).To(Equal(exitPermissionDenied))
+	})
+
+	It("should exit with the usage code for invalid usage", func() {
+		Expect(shelf("ls")).To(Equal(exitUsage))
+		Expect(shelf("ls", "dir/", "--output", "xml")).To(Equal(exitUsage))
+		Expect(shelf("search", "dir", "--limit", "many")).To(Equal(exitUsage))
+		Expect(shelf("put", filepath.Join(dir, "missing"), "dir/a")).To(Equal(exitUsage))
+		stderr.Reset()
+		Expect(run([]string{"ls", "dir/"}, stdin, stdout, stderr)).To(Equal(exitUsage))
+		Expect(strings.TrimSpace(stderr.String())).To(HavePrefix("shelf: No host given"))
+	})
+
+	It("should exit with the unavailable code when Shelf cannot be reached", func() {
+		server.Close()
+		Expect(shelf("ls", "dir/")).To(Equal(exitUnavailable))
+	})
+})
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/tomnomnom/linkheader"
+	"io"
+)
+
+// Writes results to stdout in the format asked for.
+type output struct {
+	formatter shelflib.Formatter
+	writer    io.Writer
+}
+
+func newOutput(format string, template string, writer io.Writer) (*output, *shelflib.ShelfError) {
+	if template != "" && format == shelflib.FormatTable {
+		format = shelflib.FormatTemplate
+	}
+
+	formatter, shelfErr := shelflib.NewFormatter(format, &shelflib.FormatOptions{Template: template})
+
+	if shelfErr != nil {
+		return nil, usageError(shelfErr.Message)
+	}
+
+	return &output{formatter: formatter, writer: writer}, nil
+}
+
+// Prints links resolved against the URL that was requested,
+// with the metadata of each artifact if shelf is not nil.
+func (this *output) links(shelf *shelflib.ShelfLib, base string, links linkheader.Links) *shelflib.ShelfError {
+	records, shelfErr := shelflib.NewArtifactRecords(base, links)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	if shelf != nil {
+		if shelfErr := shelf.AddMetadata(records); shelfErr != nil {
+			return shelfErr
+		}
+	}
+
+	return this.check(this.formatter.Artifacts(this.writer, records))
+}
+
+// Prints properties sorted by name.
+func (this *output) properties(metadata map[string]*shelflib.MetadataProperty) *shelflib.ShelfError {
+	return this.check(this.formatter.Metadata(this.writer, shelflib.NewPropertyRecords(metadata)))
+}
+
+func (this *output) property(prop *shelflib.MetadataProperty) *shelflib.ShelfError {
+	return this.properties(map[string]*shelflib.MetadataProperty{prop.Name: prop})
+}
+
+func (this *output) check(err error) *shelflib.ShelfError {
+	if err != nil {
+		return shelflib.CreateShelfErrorFromError(err)
+	}
+
+	return nil
+}
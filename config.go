@@ -0,0 +1,334 @@
+package shelflib
+
+import (
+	"bufio"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Environment variables read by LoadConfig.
+const (
+	HostEnvVar        = "SHELF_HOST"
+	BucketEnvVar      = "SHELF_BUCKET"
+	TokenFileEnvVar   = "SHELF_TOKEN_FILE"
+	TimeoutEnvVar     = "SHELF_TIMEOUT"
+	ProfileEnvVar     = "SHELF_PROFILE"
+	ConfigEnvVar      = "SHELF_CONFIG"
+	CredentialsEnvVar = "SHELF_CREDENTIALS"
+)
+
+// Names of the settings in Config.Sources.
+const (
+	SettingHost            = "host"
+	SettingBucket          = "bucket"
+	SettingToken           = "token"
+	SettingTokenFile       = "token_file"
+	SettingTimeout         = "timeout"
+	SettingProfile         = "profile"
+	SettingConfigFile      = "config_file"
+	SettingCredentialsFile = "credentials_file"
+)
+
+// Settings for a ShelfLib merged from a config file,
+// a credentials file, the environment and overrides.
+type Config struct {
+	Profile         string
+	ConfigFile      string
+	CredentialsFile string
+	Host            string
+	Bucket          string
+	Token           string
+	TokenFile       string
+	// Limits connecting to Shelf and waiting for a response to
+	// start, but not how long an artifact takes to transfer.
+	Timeout time.Duration
+	// Where each setting came from, keyed by setting name.
+	Sources map[string]string
+}
+
+// Config file format. Profiles are keyed by name.
+type configFile struct {
+	DefaultProfile string                    `yaml:"default_profile"`
+	Profiles       map[string]*configProfile `yaml:"profiles"`
+}
+
+type configProfile struct {
+	Host      string `yaml:"host"`
+	Bucket    string `yaml:"bucket"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	Timeout   string `yaml:"timeout"`
+}
+
+// Loads settings, lowest precedence first, from the credentials file,
+// the profile in the config file, the environment and the non-zero
+// fields of overrides, which may be nil.
+//
+// The config file defaults to ~/.config/shelf/config.yaml and the
+// credentials file to ~/.config/shelf/credentials. The credentials
+// file has netrc style entries such as "machine <host> token <token>"
+// and is only used if no other source provides a token.
+func LoadConfig(overrides *Config) (*Config, *ShelfError) {
+	var shelfErr *ShelfError
+
+	if overrides == nil {
+		overrides = &Config{}
+	}
+
+	config := &Config{Sources: make(map[string]string)}
+	configDir := defaultConfigDir()
+	config.set(SettingConfigFile, &config.ConfigFile, filepath.Join(configDir, "config.yaml"), "default")
+	config.set(SettingCredentialsFile, &config.CredentialsFile, filepath.Join(configDir, "credentials"), "default")
+	config.set(SettingProfile, &config.Profile, "default", "default")
+	config.set(SettingConfigFile, &config.ConfigFile, os.Getenv(ConfigEnvVar), "env "+ConfigEnvVar)
+	config.set(SettingConfigFile, &config.ConfigFile, overrides.ConfigFile, "override")
+	config.set(SettingCredentialsFile, &config.CredentialsFile, os.Getenv(CredentialsEnvVar), "env "+CredentialsEnvVar)
+	config.set(SettingCredentialsFile, &config.CredentialsFile, overrides.CredentialsFile, "override")
+
+	file, shelfErr := readConfigFile(config.ConfigFile)
+
+	if shelfErr != nil {
+		return config, shelfErr
+	}
+
+	config.set(SettingProfile, &config.Profile, file.DefaultProfile, "config file "+config.ConfigFile)
+	config.set(SettingProfile, &config.Profile, os.Getenv(ProfileEnvVar), "env "+ProfileEnvVar)
+	config.set(SettingProfile, &config.Profile, overrides.Profile, "override")
+
+	if profile, ok := file.Profiles[config.Profile]; ok {
+		source := "config file " + config.ConfigFile + " profile " + config.Profile
+		config.set(SettingHost, &config.Host, profile.Host, source)
+		config.set(SettingBucket, &config.Bucket, profile.Bucket, source)
+		config.setToken(profile.Token, profile.TokenFile, source)
+		shelfErr = config.setTimeout(profile.Timeout, source)
+	} else if config.Sources[SettingProfile] != "default" {
+		shelfErr = CreateShelfError("Profile "+config.Profile+" is not in "+config.ConfigFile+".", CodeBadRequest)
+	}
+
+	if shelfErr != nil {
+		return config, shelfErr
+	}
+
+	config.set(SettingHost, &config.Host, os.Getenv(HostEnvVar), "env "+HostEnvVar)
+	config.set(SettingBucket, &config.Bucket, os.Getenv(BucketEnvVar), "env "+BucketEnvVar)
+	config.setToken(os.Getenv(TokenEnvVar), "", "env "+TokenEnvVar)
+	config.setToken("", os.Getenv(TokenFileEnvVar), "env "+TokenFileEnvVar)
+	shelfErr = config.setTimeout(os.Getenv(TimeoutEnvVar), "env "+TimeoutEnvVar)
+
+	if shelfErr != nil {
+		return config, shelfErr
+	}
+
+	config.set(SettingHost, &config.Host, overrides.Host, "override")
+	config.set(SettingBucket, &config.Bucket, overrides.Bucket, "override")
+	config.setToken(overrides.Token, overrides.TokenFile, "override")
+
+	if overrides.Timeout != 0 {
+		config.Timeout = overrides.Timeout
+		config.Sources[SettingTimeout] = "override"
+	}
+
+	if config.Token == "" && config.TokenFile == "" {
+		token, err := readCredentials(config.CredentialsFile, config.Host)
+
+		if err != nil {
+			shelfErr = CreateShelfErrorFromError(err)
+
+			return config, shelfErr
+		}
+
+		config.setToken(token, "", "credentials file "+config.CredentialsFile)
+	}
+
+	return config, shelfErr
+}
+
+// Create a ShelfLib from a Config.
+func NewFromConfig(config *Config, logger *log.Logger) *ShelfLib {
+	shelfLib := NewWithTokenSource(config.TokenSource(), logger)
+
+	if config.Timeout != 0 {
+		// http.Client.Timeout would include reading the body,
+		// cutting large downloads off partway through.
+		dialer := &net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}
+		shelfLib.Request.Client = &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   config.Timeout,
+			ResponseHeaderTimeout: config.Timeout,
+			ExpectContinueTimeout: time.Second,
+		}}
+	}
+
+	return shelfLib
+}
+
+// TokenSource for the configured token or token file.
+func (this *Config) TokenSource() TokenSource {
+	if this.TokenFile != "" {
+		return NewFileTokenSource(this.TokenFile)
+	}
+
+	return StaticTokenSource(this.Token)
+}
+
+// URL of an artifact path in the configured host and bucket.
+func (this *Config) ArtifactUrl(artifactPath string) string {
+	return strings.TrimSuffix(this.Host, "/") + "/" + this.Bucket + "/artifact/" + strings.TrimPrefix(artifactPath, "/")
+}
+
+// Where a setting came from, such as "env SHELF_HOST".
+// Empty if the setting was never set.
+func (this *Config) Source(setting string) string {
+	return this.Sources[setting]
+}
+
+func (this *Config) set(setting string, field *string, value string, source string) {
+	if value == "" {
+		return
+	}
+
+	*field = value
+	this.Sources[setting] = source
+}
+
+// A token and a token file from the same source replace
+// both settings from earlier sources.
+func (this *Config) setToken(token string, tokenFile string, source string) {
+	if token == "" && tokenFile == "" {
+		return
+	}
+
+	this.Token = ""
+	this.TokenFile = ""
+	delete(this.Sources, SettingToken)
+	delete(this.Sources, SettingTokenFile)
+	this.set(SettingToken, &this.Token, token, source)
+	this.set(SettingTokenFile, &this.TokenFile, expandHome(tokenFile), source)
+}
+
+func (this *Config) setTimeout(value string, source string) *ShelfError {
+	var shelfErr *ShelfError
+
+	if value == "" {
+		return shelfErr
+	}
+
+	timeout, err := time.ParseDuration(value)
+
+	if err != nil {
+		shelfErr = CreateShelfError("Invalid timeout "+value+" from "+source+".", CodeBadRequest)
+		shelfErr.Parent = err
+
+		return shelfErr
+	}
+
+	this.Timeout = timeout
+	this.Sources[SettingTimeout] = source
+
+	return shelfErr
+}
+
+// Reads the config file. A missing file has no profiles.
+func readConfigFile(path string) (*configFile, *ShelfError) {
+	var shelfErr *ShelfError
+
+	file := &configFile{}
+	data, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return file, shelfErr
+	}
+
+	if err == nil {
+		err = yaml.Unmarshal(data, file)
+	}
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+	}
+
+	return file, shelfErr
+}
+
+// Finds the token for a host in a netrc style credentials file.
+// A missing file has no credentials.
+func readCredentials(path string, host string) (string, error) {
+	file, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	if parsed, err := url.Parse(host); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+
+	// Tokens keyed by machine. The "default" entry is keyed by "".
+	tokens := make(map[string]string)
+	machine := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanWords)
+
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case "machine":
+			scanner.Scan()
+			machine = scanner.Text()
+		case "default":
+			machine = ""
+		case "token", "password":
+			scanner.Scan()
+
+			if _, ok := tokens[machine]; !ok {
+				tokens[machine] = scanner.Text()
+			}
+		}
+	}
+
+	if token, ok := tokens[host]; ok {
+		return token, scanner.Err()
+	}
+
+	return tokens[""], scanner.Err()
+}
+
+// Directory the config and credentials files are in by default.
+func defaultConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "shelf")
+	}
+
+	return filepath.Join(expandHome("~"), ".config", "shelf")
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,150 @@
+package shelflib_test
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("LoadConfig", func() {
+	var (
+		dir             string
+		configFile      string
+		credentialsFile string
+		savedEnv        map[string]string
+		envVars         = []string{
+			"XDG_CONFIG_HOME", "SHELF_HOST", "SHELF_BUCKET", "SHELF_AUTH_TOKEN",
+			"SHELF_TOKEN_FILE", "SHELF_TIMEOUT", "SHELF_PROFILE", "SHELF_CONFIG", "SHELF_CREDENTIALS",
+		}
+	)
+
+	BeforeEach(func() {
+		savedEnv = make(map[string]string)
+
+		for _, name := range envVars {
+			savedEnv[name] = os.Getenv(name)
+			os.Unsetenv(name)
+		}
+
+		dir, _ = ioutil.TempDir("", "shelflib-config")
+		os.Setenv("XDG_CONFIG_HOME", dir)
+		configFile = filepath.Join(dir, "shelf", "config.yaml")
+		credentialsFile = filepath.Join(dir, "shelf", "credentials")
+		os.MkdirAll(filepath.Dir(configFile), 0700)
+		ioutil.WriteFile(configFile, []byte(`
+default_profile: prod
+profiles:
+  prod:
+    host: https://api.shelf.cwscloud.net/
+    bucket: builds
+    token_file: /run/secrets/shelf-token
+    timeout: 30s
+  dev:
+    host: https://dev.shelf.cwscloud.net/
+    bucket: scratch
+`), 0600)
+		ioutil.WriteFile(credentialsFile, []byte(`
+machine api.shelf.cwscloud.net token PRODTOKEN
+machine dev.shelf.cwscloud.net
+  token DEVTOKEN
+`), 0600)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+
+		for name, value := range savedEnv {
+			if value == "" {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, value)
+			}
+		}
+	})
+
+	It("should load the default profile", func() {
+		config, err := shelflib.LoadConfig(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(config.Profile).To(Equal("prod"))
+		Expect(config.Host).To(Equal("https://api.shelf.cwscloud.net/"))
+		Expect(config.Bucket).To(Equal("builds"))
+		Expect(config.TokenFile).To(Equal("/run/secrets/shelf-token"))
+		Expect(config.Token).To(Equal(""))
+		Expect(config.Timeout).To(Equal(30 * time.Second))
+		Expect(config.Source(shelflib.SettingHost)).To(Equal("config file " + configFile + " profile prod"))
+		Expect(config.Source(shelflib.SettingProfile)).To(Equal("config file " + configFile))
+	})
+
+	It("should let the environment and overrides take precedence", func() {
+		os.Setenv("SHELF_BUCKET", "nightly")
+		os.Setenv("SHELF_AUTH_TOKEN", "ENVTOKEN")
+		config, err := shelflib.LoadConfig(&shelflib.Config{Timeout: time.Minute})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(config.Bucket).To(Equal("nightly"))
+		Expect(config.Token).To(Equal("ENVTOKEN"))
+		Expect(config.TokenFile).To(Equal(""))
+		Expect(config.Timeout).To(Equal(time.Minute))
+		Expect(config.Source(shelflib.SettingBucket)).To(Equal("env SHELF_BUCKET"))
+		Expect(config.Source(shelflib.SettingToken)).To(Equal("env SHELF_AUTH_TOKEN"))
+		Expect(config.Source(shelflib.SettingTokenFile)).To(Equal(""))
+		Expect(config.Source(shelflib.SettingTimeout)).To(Equal("override"))
+	})
+
+	It("should fall back to the credentials file for the host", func() {
+		os.Setenv("SHELF_PROFILE", "dev")
+		config, err := shelflib.LoadConfig(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(config.Host).To(Equal("https://dev.shelf.cwscloud.net/"))
+		Expect(config.Token).To(Equal("DEVTOKEN"))
+		Expect(config.Source(shelflib.SettingToken)).To(Equal("credentials file " + credentialsFile))
+		Expect(config.ArtifactUrl("/a/b")).To(Equal("https://dev.shelf.cwscloud.net/scratch/artifact/a/b"))
+	})
+
+	It("should fail for an unknown profile", func() {
+		_, err := shelflib.LoadConfig(&shelflib.Config{Profile: "missing"})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Message).To(ContainSubstring("missing"))
+	})
+
+	It("should fail for an invalid timeout", func() {
+		os.Setenv("SHELF_TIMEOUT", "soon")
+		_, err := shelflib.LoadConfig(nil)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Message).To(ContainSubstring("env SHELF_TIMEOUT"))
+	})
+
+	It("should create a working ShelfLib", func() {
+		config, _ := shelflib.LoadConfig(&shelflib.Config{Token: validToken})
+		shelf = shelflib.NewFromConfig(config, logger)
+		transport := shelf.Request.Client.Transport.(*http.Transport)
+		Expect(transport.TLSHandshakeTimeout).To(Equal(30 * time.Second))
+		Expect(transport.ResponseHeaderTimeout).To(Equal(30 * time.Second))
+	})
+
+	It("should not limit transfers by the timeout", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			Expect(request.Header.Get("Authorization")).To(Equal(validToken))
+			writer.Write([]byte("Simple "))
+			writer.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			writer.Write([]byte("Text File"))
+		}))
+		defer server.Close()
+
+		config, _ := shelflib.LoadConfig(&shelflib.Config{Token: validToken, Timeout: 50 * time.Millisecond})
+		shelf = shelflib.NewFromConfig(config, logger)
+		body, err := shelf.DownloadArtifact(server.URL + "/test/artifact/file")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer (*body).Close()
+
+		content, readErr := ioutil.ReadAll(*body)
+		Expect(readErr).ShouldNot(HaveOccurred())
+		Expect(string(content)).To(Equal("Simple Text File"))
+	})
+})
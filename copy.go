@@ -0,0 +1,155 @@
+package shelflib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// Properties Shelf sets on upload. CopyArtifact leaves them to
+// the destination rather than copying them.
+var uploadProperties = []string{PropertyArtifactName, PropertyArtifactPath, PropertyMd5Hash, PropertySha256Hash, PropertyCreatedDate}
+
+// Options for CopyArtifact.
+type CopyOptions struct {
+	// Writes the destination, for copies to another Shelf host or
+	// with another token. Defaults to the ShelfLib that reads the source.
+	Destination *ShelfLib
+	// Metadata properties that are not copied.
+	SkipMetadata []string
+	// Succeed if the destination already exists with the same content,
+	// copying the metadata to it. Checked before anything is downloaded.
+	SkipIdentical bool
+}
+
+// Copy an artifact and its metadata, mutable and immutable, from src to
+// dst. The download is streamed into the upload without a temporary file.
+// The sha256 of what was streamed must match the sha256Hash of both the
+// source and the destination, otherwise CodeChecksumMismatch is returned
+// and, as artifacts cannot be overwritten, the destination is marked
+// incomplete the way Publish marks it.
+func (this *ShelfLib) CopyArtifact(src string, dst string, opts *CopyOptions) *ShelfError {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	shelfLib, end := this.operation("CopyArtifact")
+	defer end()
+
+	destination := shelfLib
+
+	if opts.Destination != nil {
+		destination = opts.Destination.WithContext(shelfLib.Context())
+	}
+
+	metadata, shelfErr := shelfLib.GetMetadata(src)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	sourceHash := ""
+
+	if prop, ok := metadata[PropertySha256Hash]; ok {
+		sourceHash = prop.Value
+	}
+
+	exists := false
+
+	if opts.SkipIdentical && sourceHash != "" {
+		_, shelfErr = destination.ListArtifact(dst)
+
+		if shelfErr == nil {
+			exists = true
+
+			if shelfErr = destination.compareContent(dst, sourceHash); shelfErr != nil {
+				return shelfErr
+			}
+		} else if !IsNotFound(shelfErr) {
+			return shelfErr
+		}
+	}
+
+	if !exists {
+		if shelfErr = shelfLib.streamCopy(src, dst, sourceHash, destination); shelfErr != nil {
+			return shelfErr
+		}
+	}
+
+	skipped := make(map[string]bool)
+
+	for _, name := range append(uploadProperties, opts.SkipMetadata...) {
+		skipped[name] = true
+	}
+
+	copied := make(map[string]*MetadataProperty)
+
+	for name, prop := range metadata {
+		if !skipped[name] {
+			copied[name] = CreateMetadataProperty(name, prop.Value, prop.Immutable)
+		}
+	}
+
+	if len(copied) == 0 {
+		return nil
+	}
+
+	if !exists {
+		_, shelfErr = destination.UpdateMetadata(dst, copied)
+
+		return shelfErr
+	}
+
+	// Only what differs is sent, as immutable properties
+	// copied before cannot be written again.
+	_, shelfErr = destination.ApplyMetadata(dst, copied, nil)
+
+	return shelfErr
+}
+
+// Streams the content of src into an upload of dst and checks the
+// sha256 of what was streamed against both sides.
+func (this *ShelfLib) streamCopy(src string, dst string, sourceHash string, destination *ShelfLib) *ShelfError {
+	body, shelfErr := this.DownloadArtifact(src)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	defer (*body).Close()
+
+	hash := sha256.New()
+	request, end := destination.requestFor("UploadArtifact")
+	response, shelfErr := request.UploadStream(dst, io.TeeReader(*body, hash))
+	end()
+
+	if shelfErr == nil {
+		shelfErr = CheckResponseStatus(response)
+	}
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	copiedHash := hex.EncodeToString(hash.Sum(nil))
+
+	if sourceHash != "" && copiedHash != sourceHash {
+		shelfErr = CreateShelfError("Copied "+dst+" from "+src+" with sha256 "+copiedHash+", expected "+sourceHash+".", CodeChecksumMismatch)
+
+		return destination.markIncomplete(dst, PublishStateProperty, PublishIncomplete, shelfErr)
+	}
+
+	destinationMetadata, shelfErr := destination.GetMetadata(dst)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	if prop, ok := destinationMetadata[PropertySha256Hash]; ok && prop.Value != copiedHash {
+		shelfErr = CreateShelfError("Uploaded "+dst+" has sha256 "+prop.Value+", expected "+copiedHash+".", CodeChecksumMismatch)
+
+		return destination.markIncomplete(dst, PublishStateProperty, PublishIncomplete, shelfErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package shelflib_test
+
+import (
+	"encoding/json"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var _ = Describe("CopyArtifact", func() {
+	var metrics = shelflib.NewExpvarMetrics("shelflib_copy_test")
+
+	var (
+		server *shelftest.Server
+		client *shelflib.ShelfLib
+		src    string
+		dst    string
+	)
+
+	BeforeEach(func() {
+		server = shelftest.NewServer(validToken)
+		server.PutArtifact("dev", "builds/app.tar.gz", []byte("app"))
+		server.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("version", "1.2", true))
+		server.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("status", "tested", false))
+		client = server.NewShelf(validToken)
+		src = server.ArtifactUrl("dev", "builds/app.tar.gz")
+		dst = server.ArtifactUrl("prod", "builds/app.tar.gz")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should copy content and metadata between buckets", func() {
+		Expect(client.CopyArtifact(src, dst, nil)).To(BeNil())
+
+		content, metadata, ok := server.Artifact("prod", "builds/app.tar.gz")
+		Expect(ok).To(BeTrue())
+		Expect(string(content)).To(Equal("app"))
+		Expect(metadata["version"]).To(Equal(shelflib.CreateMetadataProperty("version", "1.2", true)))
+		Expect(metadata["status"]).To(Equal(shelflib.CreateMetadataProperty("status", "tested", false)))
+		Expect(metadata[shelflib.PropertyArtifactPath].Value).To(Equal("/builds/app.tar.gz"))
+	})
+
+	It("should copy to another host with another client", func() {
+		other := shelftest.NewServer("OTHERTOKEN")
+		defer other.Close()
+
+		dst = other.ArtifactUrl("prod", "promoted/app.tar.gz")
+		opts := &shelflib.CopyOptions{Destination: other.NewShelf("OTHERTOKEN"), SkipMetadata: []string{"status"}}
+		Expect(client.CopyArtifact(src, dst, opts)).To(BeNil())
+
+		content, metadata, _ := other.Artifact("prod", "promoted/app.tar.gz")
+		Expect(string(content)).To(Equal("app"))
+		Expect(metadata["version"].Value).To(Equal("1.2"))
+		Expect(metadata).ShouldNot(HaveKey("status"))
+		Expect(metadata[shelflib.PropertyArtifactName].Value).To(Equal("app.tar.gz"))
+	})
+
+	It("should skip identical destinations", func() {
+		Expect(client.CopyArtifact(src, dst, nil)).To(BeNil())
+		Expect(client.CopyArtifact(src, dst, nil).Code).To(Equal(shelflib.CodeDuplicateArtifact))
+
+		server.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("status", "released", false))
+		server.ResetRequests()
+		Expect(client.CopyArtifact(src, dst, &shelflib.CopyOptions{SkipIdentical: true})).To(BeNil())
+
+		for _, request := range server.Requests() {
+			Expect(request).ShouldNot(Equal("GET /dev/artifact/builds/app.tar.gz"))
+		}
+
+		_, metadata, _ := server.Artifact("prod", "builds/app.tar.gz")
+		Expect(metadata["status"].Value).To(Equal("released"))
+
+		server.PutArtifact("dev", "builds/other", []byte("other"))
+		shelfErr := client.CopyArtifact(server.ArtifactUrl("dev", "builds/other"), dst, &shelflib.CopyOptions{SkipIdentical: true})
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeContentMismatch))
+	})
+
+	It("should fail when the streamed content does not match", func() {
+		client.Use(func(next shelflib.Doer) shelflib.Doer {
+			return shelflib.DoerFunc(func(request *http.Request) (*http.Response, error) {
+				response, err := next.Do(request)
+
+				if err == nil && request.Method == "GET" && strings.HasSuffix(request.URL.Path, "/app.tar.gz") {
+					response.Body = ioutil.NopCloser(strings.NewReader("corrupted"))
+				}
+
+				return response, err
+			})
+		})
+
+		shelfErr := client.CopyArtifact(src, dst, nil)
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeChecksumMismatch))
+		Expect(shelfErr.Message).To(ContainSubstring(dst))
+
+		_, metadata, ok := server.Artifact("prod", "builds/app.tar.gz")
+		Expect(ok).To(BeTrue())
+		Expect(metadata[shelflib.PublishStateProperty]).To(Equal(shelflib.CreateMetadataProperty(shelflib.PublishStateProperty, shelflib.PublishIncomplete, false)))
+		Expect(metadata).ShouldNot(HaveKey("version"))
+	})
+
+	It("should count the streamed bytes once the upload is accepted", func() {
+		client.Request.Metrics = metrics
+		Expect(client.CopyArtifact(src, dst, nil)).To(BeNil())
+		Expect(client.CopyArtifact(src, dst, nil)).ShouldNot(BeNil())
+
+		var transfers map[string]interface{}
+		Expect(json.Unmarshal([]byte(metrics.Transfers.Get("UploadArtifact:upload").String()), &transfers)).To(Succeed())
+		Expect(transfers["count"]).To(Equal(1.0))
+		Expect(transfers["sum"]).To(Equal(3.0))
+	})
+
+	It("should fail when the source does not exist", func() {
+		shelfErr := client.CopyArtifact(server.ArtifactUrl("dev", "missing"), dst, nil)
+		Expect(shelflib.IsNotFound(shelfErr)).To(BeTrue())
+	})
+})
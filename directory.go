@@ -0,0 +1,764 @@
+package shelflib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// What UploadDirectory does with symbolic links.
+type SymlinkPolicy string
+
+const (
+	// Leave symlinks out and report them as skipped. The default.
+	SymlinkSkip SymlinkPolicy = "skip"
+	// Upload what symlinks point to. Links to directories are walked.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// Report symlinks as failures.
+	SymlinkFail SymlinkPolicy = "fail"
+)
+
+// Transfers in parallel unless Concurrency says otherwise.
+const DefaultConcurrency = 4
+
+// Options for UploadDirectory.
+type UploadDirectoryOptions struct {
+	// Files uploaded at once. Defaults to DefaultConcurrency.
+	Concurrency int
+	// Only files matching one of these globs are uploaded, if any are given.
+	Include []string
+	// Files and directories matching one of these globs are left out.
+	Exclude  []string
+	Symlinks SymlinkPolicy
+	// Skip files that are already uploaded with the same content,
+	// with UploadArtifactFromFileOnce, instead of failing them. Their
+	// metadata is still brought in line with the Metadata callback.
+	SkipIdentical bool
+	// Returns metadata to set on an artifact once it is uploaded.
+	// Called with the path relative to the directory and the
+	// local file path. May return nil.
+	Metadata func(relativePath string, filePath string) map[string]*MetadataProperty
+}
+
+// Result of transferring many artifacts. Paths are relative
+// to the directory or prefix that was transferred.
+type TransferReport struct {
+	// Sorted paths that were transferred.
+	Transferred []string
+	// Paths that were left out, and why.
+	Skipped map[string]string
+	Failed  map[string]*ShelfError
+	// Bytes transferred.
+	Bytes int64
+	lock  sync.Mutex
+}
+
+func newTransferReport() *TransferReport {
+	return &TransferReport{Transferred: make([]string, 0), Skipped: make(map[string]string), Failed: make(map[string]*ShelfError)}
+}
+
+// Nil if nothing failed, otherwise an error with the code
+// of one of the failures that counts them.
+func (this *TransferReport) Err() *ShelfError {
+	if len(this.Failed) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(this.Failed))
+
+	for relativePath := range this.Failed {
+		paths = append(paths, relativePath)
+	}
+
+	sort.Strings(paths)
+	first := this.Failed[paths[0]]
+	shelfErr := CreateShelfError(fmt.Sprintf("%d of %d failed, first %s: %s", len(paths), len(paths)+len(this.Transferred), paths[0], first.Message), first.Code)
+	shelfErr.Parent = first
+
+	return shelfErr
+}
+
+func (this *TransferReport) transferred(relativePath string, bytes int64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Transferred = append(this.Transferred, relativePath)
+	this.Bytes += bytes
+}
+
+func (this *TransferReport) skipped(relativePath string, reason string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Skipped[relativePath] = reason
+}
+
+func (this *TransferReport) failed(relativePath string, shelfErr *ShelfError) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Failed[relativePath] = shelfErr
+}
+
+func (this *TransferReport) sort() {
+	sort.Strings(this.Transferred)
+}
+
+// Upload every file under localDir to the same relative path
+// under remotePrefix, the URL of a directory in a bucket. Failures
+// of single files are in the report. An error is only returned
+// if localDir cannot be read.
+func (this *ShelfLib) UploadDirectory(localDir string, remotePrefix string, opts *UploadDirectoryOptions) (*TransferReport, *ShelfError) {
+	if opts == nil {
+		opts = &UploadDirectoryOptions{}
+	}
+
+	shelfLib, end := this.operation("UploadDirectory")
+	defer end()
+
+	report := newTransferReport()
+	files, shelfErr := listLocal(localDir, opts.Include, opts.Exclude, opts.Symlinks, report)
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	forEachConcurrently(sortedKeys(files), opts.Concurrency, func(relativePath string) {
+		shelfLib.uploadFile(files[relativePath], remotePrefix, relativePath, opts.SkipIdentical, opts.Metadata, report)
+	})
+
+	report.sort()
+
+	return report, nil
+}
+
+// Uploads one file of a directory and sets the metadata
+// from the callback, if any. The outcome goes in the report.
+func (this *ShelfLib) uploadFile(filePath string, remotePrefix string, relativePath string, skipIdentical bool, metadataFor func(string, string) map[string]*MetadataProperty, report *TransferReport) {
+	if ctxErr := this.Context().Err(); ctxErr != nil {
+		report.failed(relativePath, CreateShelfErrorFromError(ctxErr))
+
+		return
+	}
+
+	remotePath := JoinArtifactPath(remotePrefix, relativePath)
+	uploaded := true
+
+	if skipIdentical {
+		var shelfErr *ShelfError
+
+		uploaded, shelfErr = this.UploadArtifactFromFileOnce(remotePath, filePath, nil)
+
+		if shelfErr != nil {
+			report.failed(relativePath, shelfErr)
+
+			return
+		}
+	} else if shelfErr := this.UploadArtifactFromFile(remotePath, filePath); shelfErr != nil {
+		report.failed(relativePath, shelfErr)
+
+		return
+	}
+
+	if metadataFor != nil {
+		if metadata := metadataFor(relativePath, filePath); len(metadata) > 0 {
+			if shelfErr := this.applyFileMetadata(remotePath, metadata, uploaded); shelfErr != nil {
+				report.failed(relativePath, shelfErr)
+
+				return
+			}
+		}
+	}
+
+	if !uploaded {
+		report.skipped(relativePath, "identical")
+
+		return
+	}
+
+	var size int64
+
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+	}
+
+	report.transferred(relativePath, size)
+}
+
+// Sets metadata on a file's artifact. An artifact that was already
+// there may have it from an earlier run, so only what differs is
+// sent, as immutable properties cannot be written again.
+func (this *ShelfLib) applyFileMetadata(remotePath string, metadata map[string]*MetadataProperty, uploaded bool) *ShelfError {
+	if uploaded {
+		_, shelfErr := this.UpdateMetadata(remotePath, metadata)
+
+		return shelfErr
+	}
+
+	_, shelfErr := this.ApplyMetadata(remotePath, metadata, nil)
+
+	return shelfErr
+}
+
+// Returned by a WalkFunc to leave out the contents of a directory.
+// Compare with errors.Is.
+var ErrSkipDirectory error = codeError{code: CodeSkipDirectory, message: "Skip this directory."}
+
+// Called by Walk for every artifact and directory under the prefix.
+// relativePath has no trailing slash, even for directories. Returning
+// an error other than ErrSkipDirectory ends the walk with that error.
+type WalkFunc func(relativePath string, record *ArtifactRecord) error
+
+// Lists the directory at prefix, and every directory in it, calling
+// walk for each artifact and directory in order of path.
+func (this *ShelfLib) Walk(prefix string, walk WalkFunc) *ShelfError {
+	shelfLib, end := this.operation("Walk")
+	defer end()
+
+	root := JoinArtifactPath(prefix, "")
+	rootUrl, err := url.Parse(root)
+
+	if err != nil {
+		return CreateShelfErrorFromError(err)
+	}
+
+	return shelfLib.walk(rootUrl.Path, root, walk)
+}
+
+func (this *ShelfLib) walk(rootPath string, directoryUrl string, walk WalkFunc) *ShelfError {
+	if err := this.Context().Err(); err != nil {
+		return CreateShelfErrorFromError(err)
+	}
+
+	links, shelfErr := this.ListArtifact(directoryUrl)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	records, shelfErr := NewArtifactRecords(directoryUrl, *links)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	sort.Slice(records, func(i int, j int) bool {
+		return records[i].Url < records[j].Url
+	})
+
+	for _, record := range records {
+		if record.Rel != "item" {
+			continue
+		}
+
+		recordUrl, err := url.Parse(record.Url)
+
+		if err != nil {
+			return CreateShelfErrorFromError(err)
+		}
+
+		relativePath := strings.Trim(strings.TrimPrefix(recordUrl.Path, rootPath), "/")
+		err = walk(relativePath, record)
+
+		if errors.Is(err, ErrSkipDirectory) {
+			continue
+		}
+
+		if shelfErr, ok := AsShelfError(err); ok {
+			return shelfErr
+		}
+
+		if err != nil {
+			return CreateShelfErrorFromError(err)
+		}
+
+		if isDirectoryRecord(record) {
+			if shelfErr = this.walk(rootPath, record.Url, walk); shelfErr != nil {
+				return shelfErr
+			}
+		}
+	}
+
+	return nil
+}
+
+func isDirectoryRecord(record *ArtifactRecord) bool {
+	return record.Title == "directory" || strings.HasSuffix(record.Url, "/")
+}
+
+// Added to the name of a downloaded file for its metadata sidecar.
+const SidecarSuffix = ".metadata.json"
+
+// Options for DownloadDirectory.
+type DownloadDirectoryOptions struct {
+	// Files downloaded at once. Defaults to DefaultConcurrency.
+	Concurrency int
+	// Only artifacts matching one of these globs are downloaded, if any are given.
+	Include []string
+	// Artifacts and directories matching one of these globs are left out.
+	Exclude []string
+	// Compare the sha256 of every download with the sha256Hash
+	// metadata of the artifact.
+	VerifyChecksum bool
+	// Write the metadata of each artifact next to it, to the
+	// file name with SidecarSuffix added, in the JSON format of
+	// the metadata in ArtifactSchema.
+	Sidecar bool
+}
+
+// Download every artifact under remotePrefix, the URL of a directory in
+// a bucket, to the same relative path under localDir. Files are written
+// to a temporary file and renamed, so a failed download never leaves a
+// partial file. Local files with the sha256 of the artifact are not
+// downloaded again. Failures of single artifacts are in the report.
+func (this *ShelfLib) DownloadDirectory(remotePrefix string, localDir string, opts *DownloadDirectoryOptions) (*TransferReport, *ShelfError) {
+	if opts == nil {
+		opts = &DownloadDirectoryOptions{}
+	}
+
+	shelfLib, end := this.operation("DownloadDirectory")
+	defer end()
+
+	report := newTransferReport()
+	artifacts := make(map[string]string)
+	filter := newPathFilter(opts.Include, opts.Exclude)
+
+	shelfErr := shelfLib.Walk(remotePrefix, func(relativePath string, record *ArtifactRecord) error {
+		if filter.excluded(relativePath) {
+			report.skipped(relativePath, "excluded")
+
+			if isDirectoryRecord(record) {
+				return ErrSkipDirectory
+			}
+		} else if isDirectoryRecord(record) {
+			return nil
+		} else if !filter.included(relativePath) {
+			report.skipped(relativePath, "not included")
+		} else {
+			artifacts[relativePath] = record.Url
+		}
+
+		return nil
+	})
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	forEachConcurrently(sortedKeys(artifacts), opts.Concurrency, func(relativePath string) {
+		size, shelfErr := shelfLib.downloadInto(artifacts[relativePath], localDir, relativePath, opts)
+
+		if shelfErr != nil {
+			report.failed(relativePath, shelfErr)
+		} else if size < 0 {
+			report.skipped(relativePath, "unchanged")
+		} else {
+			report.transferred(relativePath, size)
+		}
+	})
+
+	report.sort()
+
+	return report, nil
+}
+
+// Downloads one artifact of DownloadDirectory. Returns the size
+// written, or -1 if the local file was already up to date.
+func (this *ShelfLib) downloadInto(artifactUrl string, localDir string, relativePath string, opts *DownloadDirectoryOptions) (int64, *ShelfError) {
+	if err := this.Context().Err(); err != nil {
+		return 0, CreateShelfErrorFromError(err)
+	}
+
+	// Shelf paths cannot contain "..", but a listing is not trusted
+	// to stay inside localDir.
+	cleaned := path.Clean("/" + relativePath)[1:]
+
+	if cleaned != relativePath || cleaned == "" {
+		return 0, CreateShelfError("Invalid artifact path "+relativePath, CodeInvalidArtifactName)
+	}
+
+	filePath := filepath.Join(localDir, filepath.FromSlash(relativePath))
+	localHash, localErr := fileSha256(filePath)
+
+	var metadata map[string]*MetadataProperty
+
+	if localErr == nil || opts.VerifyChecksum || opts.Sidecar {
+		var shelfErr *ShelfError
+
+		metadata, shelfErr = this.GetMetadata(artifactUrl)
+
+		if shelfErr != nil {
+			return 0, shelfErr
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return 0, CreateShelfErrorFromError(err)
+	}
+
+	remoteHash := ""
+
+	if prop, ok := metadata[PropertySha256Hash]; ok {
+		remoteHash = prop.Value
+	}
+
+	size := int64(-1)
+
+	if localErr != nil || remoteHash == "" || localHash != remoteHash {
+		var shelfErr *ShelfError
+
+		size, shelfErr = this.downloadAtomically(artifactUrl, filePath, remoteHash, opts.VerifyChecksum)
+
+		if shelfErr != nil {
+			return 0, shelfErr
+		}
+	}
+
+	if opts.Sidecar {
+		records := make(map[string]*PropertyRecord)
+
+		for _, record := range NewPropertyRecords(metadata) {
+			records[record.Name] = record
+		}
+
+		data, err := json.MarshalIndent(records, "", "  ")
+
+		if err == nil {
+			err = writeFileAtomically(filePath+SidecarSuffix, func(file *os.File) error {
+				_, err := file.Write(append(data, '\n'))
+
+				return err
+			})
+		}
+
+		if err != nil {
+			return 0, CreateShelfErrorFromError(err)
+		}
+	}
+
+	return size, nil
+}
+
+// Downloads to a temporary file next to filePath and renames it.
+// With verify, the download must have the sha256 expectedHash.
+func (this *ShelfLib) downloadAtomically(artifactUrl string, filePath string, expectedHash string, verify bool) (int64, *ShelfError) {
+	var (
+		size     int64
+		shelfErr *ShelfError
+	)
+
+	err := writeFileAtomically(filePath, func(file *os.File) error {
+		file.Close()
+
+		if shelfErr = this.DownloadArtifactToFile(artifactUrl, file.Name()); shelfErr != nil {
+			return shelfErr
+		}
+
+		hash, err := fileSha256(file.Name())
+
+		if err != nil {
+			return err
+		}
+
+		if verify && expectedHash == "" {
+			shelfErr = CreateShelfError(artifactUrl+" has no "+PropertySha256Hash+" to verify against", CodeChecksumMismatch)
+
+			return shelfErr
+		}
+
+		if verify && hash != expectedHash {
+			shelfErr = CreateShelfError("Checksum of "+artifactUrl+" is "+hash+", expected "+expectedHash, CodeChecksumMismatch)
+
+			return shelfErr
+		}
+
+		info, err := os.Stat(file.Name())
+
+		if err == nil {
+			size = info.Size()
+		}
+
+		return err
+	})
+
+	if shelfErr != nil {
+		return 0, shelfErr
+	}
+
+	if err != nil {
+		return 0, CreateShelfErrorFromError(err)
+	}
+
+	return size, nil
+}
+
+// Calls write with a temporary file in the directory of filePath and
+// renames it to filePath, with mode 0644, if write succeeds. The file
+// may be closed by write. It is removed if anything fails.
+func writeFileAtomically(filePath string, write func(file *os.File) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	err = write(file)
+	closeErr := file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	// Closing twice is fine when write already closed it.
+	if closeErr != nil && !errors.Is(closeErr, os.ErrClosed) {
+		return closeErr
+	}
+
+	// Temporary files are only readable by their owner.
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filePath)
+}
+
+// Hex encoded sha256 of a file, as in the sha256Hash property.
+func fileSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// URL of relativePath under prefix, the URL of a directory.
+func JoinArtifactPath(prefix string, relativePath string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(relativePath, "/")
+}
+
+// Files under localDir to upload, keyed by their slash separated
+// path relative to it. Files that are left out go in the report.
+func listLocal(localDir string, include []string, exclude []string, symlinks SymlinkPolicy, report *TransferReport) (map[string]string, *ShelfError) {
+	info, err := os.Stat(localDir)
+
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	if err != nil {
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	files := make(map[string]string)
+	walkLocal(localDir, "", symlinks, newPathFilter(include, exclude), files, report, map[string]bool{})
+
+	return files, nil
+}
+
+// Adds the files under dir to files, keyed by their path relative to
+// the directory being uploaded. visited holds the real paths of the
+// directories being walked so that symlink loops end.
+func walkLocal(dir string, relativeDir string, symlinks SymlinkPolicy, filter *pathFilter, files map[string]string, report *TransferReport, visited map[string]bool) {
+	if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+		if visited[realDir] {
+			report.skipped(relativeDir, "symlink loop")
+
+			return
+		}
+
+		visited[realDir] = true
+		defer delete(visited, realDir)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		report.failed(relativeDir, CreateShelfErrorFromError(err))
+
+		return
+	}
+
+	for _, entry := range entries {
+		filePath := filepath.Join(dir, entry.Name())
+		relativePath := path.Join(relativeDir, entry.Name())
+		isDir := entry.IsDir()
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			switch symlinks {
+			case SymlinkFollow:
+				target, err := os.Stat(filePath)
+
+				if err != nil {
+					report.failed(relativePath, CreateShelfErrorFromError(err))
+
+					continue
+				}
+
+				isDir = target.IsDir()
+			case SymlinkFail:
+				report.failed(relativePath, CreateShelfError("Symlinks are not allowed: "+filePath, CodeSymlinkNotAllowed))
+
+				continue
+			default:
+				report.skipped(relativePath, "symlink")
+
+				continue
+			}
+		}
+
+		if filter.excluded(relativePath) {
+			report.skipped(relativePath, "excluded")
+
+			continue
+		}
+
+		if isDir {
+			walkLocal(filePath, relativePath, symlinks, filter, files, report, visited)
+		} else if !entry.Mode().IsRegular() && entry.Mode()&os.ModeSymlink == 0 {
+			report.skipped(relativePath, "not a regular file")
+		} else if !filter.included(relativePath) {
+			report.skipped(relativePath, "not included")
+		} else {
+			files[relativePath] = filePath
+		}
+	}
+}
+
+// Calls do for every value, from at most concurrency goroutines.
+func forEachConcurrently(values []string, concurrency int, do func(value string)) {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	work := make(chan string)
+	group := sync.WaitGroup{}
+
+	for i := 0; i < concurrency && i < len(values); i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			for value := range work {
+				do(value)
+			}
+		}()
+	}
+
+	for _, value := range values {
+		work <- value
+	}
+
+	close(work)
+	group.Wait()
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Include and exclude globs. A glob containing a slash is matched
+// against the whole relative path, otherwise against the last
+// element of it. "*" and "?" do not match slashes, "**" does.
+type pathFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newPathFilter(include []string, exclude []string) *pathFilter {
+	return &pathFilter{include: compileGlobs(include), exclude: compileGlobs(exclude)}
+}
+
+func (this *pathFilter) included(relativePath string) bool {
+	return len(this.include) == 0 || matchesAny(this.include, relativePath)
+}
+
+func (this *pathFilter) excluded(relativePath string) bool {
+	return matchesAny(this.exclude, relativePath)
+}
+
+func matchesAny(globs []*regexp.Regexp, relativePath string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(relativePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(globs))
+
+	for _, glob := range globs {
+		compiled = append(compiled, globRegexp(glob))
+	}
+
+	return compiled
+}
+
+func globRegexp(glob string) *regexp.Regexp {
+	expression := strings.Builder{}
+
+	// Without a slash the glob may match in any directory.
+	if strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+		expression.WriteString("^")
+	} else {
+		expression.WriteString("^(.*/)?")
+	}
+
+	glob = strings.Trim(glob, "/")
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expression.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expression.WriteString("[^/]*")
+		case glob[i] == '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	expression.WriteString("$")
+
+	return regexp.MustCompile(expression.String())
+}
@@ -0,0 +1,247 @@
+package shelflib_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Writes files, keyed by slash separated relative path, under dir.
+func writeFiles(dir string, files map[string]string) {
+	for relativePath, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(relativePath))
+		Expect(os.MkdirAll(filepath.Dir(filePath), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filePath, []byte(content), 0644)).To(Succeed())
+	}
+}
+
+var _ = Describe("UploadDirectory", func() {
+	var (
+		server *shelftest.Server
+		client *shelflib.ShelfLib
+		dir    string
+		prefix string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "upload")
+		Expect(err).ShouldNot(HaveOccurred())
+		writeFiles(dir, map[string]string{
+			"app.tar.gz":      "app",
+			"docs/readme.txt": "readme",
+			"docs/api/a.txt":  "api",
+			"build/tmp.o":     "object",
+		})
+
+		server = shelftest.NewServer(validToken)
+		client = server.NewShelf(validToken)
+		prefix = server.ArtifactUrl("test", "builds/1.0")
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should mirror the directory under the prefix", func() {
+		report, shelfErr := client.UploadDirectory(dir, prefix, &shelflib.UploadDirectoryOptions{Concurrency: 2})
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Err()).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"app.tar.gz", "build/tmp.o", "docs/api/a.txt", "docs/readme.txt"}))
+		Expect(report.Bytes).To(Equal(int64(18)))
+
+		content, _, ok := server.Artifact("test", "builds/1.0/docs/api/a.txt")
+		Expect(ok).To(BeTrue())
+		Expect(string(content)).To(Equal("api"))
+	})
+
+	It("should apply include and exclude globs", func() {
+		report, _ := client.UploadDirectory(dir, prefix, &shelflib.UploadDirectoryOptions{
+			Include: []string{"*.txt", "*.gz"},
+			Exclude: []string{"docs/api", "**/tmp.*"},
+		})
+		Expect(report.Transferred).To(Equal([]string{"app.tar.gz", "docs/readme.txt"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"docs/api": "excluded", "build/tmp.o": "excluded"}))
+	})
+
+	It("should follow, skip or fail on symlinks", func() {
+		Expect(os.Symlink(filepath.Join(dir, "docs"), filepath.Join(dir, "linked"))).To(Succeed())
+
+		report, _ := client.UploadDirectory(dir, prefix, nil)
+		Expect(report.Skipped).To(HaveKeyWithValue("linked", "symlink"))
+
+		report, _ = client.UploadDirectory(dir, prefix, &shelflib.UploadDirectoryOptions{Symlinks: shelflib.SymlinkFail, Include: []string{"linked"}})
+		Expect(report.Failed["linked"].Code).To(Equal(shelflib.CodeSymlinkNotAllowed))
+
+		report, _ = client.UploadDirectory(dir, prefix, &shelflib.UploadDirectoryOptions{Symlinks: shelflib.SymlinkFollow, Include: []string{"linked/**"}})
+		Expect(report.Transferred).To(Equal([]string{"linked/api/a.txt", "linked/readme.txt"}))
+	})
+
+	It("should set metadata from the callback", func() {
+		report, _ := client.UploadDirectory(dir, prefix, &shelflib.UploadDirectoryOptions{
+			Include: []string{"app.tar.gz"},
+			Metadata: func(relativePath string, filePath string) map[string]*shelflib.MetadataProperty {
+				return map[string]*shelflib.MetadataProperty{"source": shelflib.CreateMetadataProperty("source", relativePath, false)}
+			},
+		})
+		Expect(report.Err()).To(BeNil())
+
+		_, metadata, _ := server.Artifact("test", "builds/1.0/app.tar.gz")
+		Expect(metadata["source"].Value).To(Equal("app.tar.gz"))
+	})
+
+	It("should report failed files and keep going", func() {
+		server.PutArtifact("test", "builds/1.0/app.tar.gz", []byte("existing"))
+
+		report, shelfErr := client.UploadDirectory(dir, prefix, nil)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Transferred).To(HaveLen(3))
+		Expect(report.Failed["app.tar.gz"].Code).To(Equal(shelflib.CodeDuplicateArtifact))
+		Expect(report.Err().Code).To(Equal(shelflib.CodeDuplicateArtifact))
+	})
+
+	It("should fail if the directory cannot be read", func() {
+		_, shelfErr := client.UploadDirectory(filepath.Join(dir, "missing"), prefix, nil)
+		Expect(shelfErr).ShouldNot(BeNil())
+	})
+})
+
+var _ = Describe("DownloadDirectory", func() {
+	var (
+		server *shelftest.Server
+		client *shelflib.ShelfLib
+		dir    string
+		prefix string
+	)
+
+	readFile := func(relativePath string) string {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(relativePath)))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "download")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		server = shelftest.NewServer(validToken)
+		server.PutArtifact("test", "builds/1.0/app.tar.gz", []byte("app"))
+		server.PutArtifact("test", "builds/1.0/docs/readme.txt", []byte("readme"))
+		server.PutArtifact("test", "builds/1.0/docs/api/a.txt", []byte("api"))
+		server.PutArtifact("test", "builds/2.0/other", []byte("other"))
+		client = server.NewShelf(validToken)
+		prefix = server.ArtifactUrl("test", "builds/1.0")
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should walk the subtree in order", func() {
+		walked := make([]string, 0)
+		shelfErr := client.Walk(prefix, func(relativePath string, record *shelflib.ArtifactRecord) error {
+			walked = append(walked, relativePath+" "+record.Title)
+
+			if relativePath == "docs/api" {
+				return shelflib.ErrSkipDirectory
+			}
+
+			return nil
+		})
+		Expect(shelfErr).To(BeNil())
+		Expect(walked).To(Equal([]string{"app.tar.gz artifact", "docs directory", "docs/api directory", "docs/readme.txt artifact"}))
+	})
+
+	It("should match wrapped skips and end the walk on other errors", func() {
+		walked := make([]string, 0)
+		shelfErr := client.Walk(prefix, func(relativePath string, record *shelflib.ArtifactRecord) error {
+			walked = append(walked, relativePath)
+
+			switch relativePath {
+			case "docs/api":
+				return fmt.Errorf("leaving out %s: %w", relativePath, shelflib.ErrSkipDirectory)
+			case "docs/readme.txt":
+				return errors.New("stop")
+			}
+
+			return nil
+		})
+		Expect(shelfErr.Message).To(Equal("stop"))
+		Expect(walked).To(Equal([]string{"app.tar.gz", "docs", "docs/api", "docs/readme.txt"}))
+	})
+
+	It("should mirror the subtree locally", func() {
+		report, shelfErr := client.DownloadDirectory(prefix, dir, &shelflib.DownloadDirectoryOptions{VerifyChecksum: true})
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Err()).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"app.tar.gz", "docs/api/a.txt", "docs/readme.txt"}))
+		Expect(report.Bytes).To(Equal(int64(12)))
+		Expect(readFile("docs/api/a.txt")).To(Equal("api"))
+
+		entries, _ := ioutil.ReadDir(filepath.Join(dir, "docs"))
+		Expect(entries).To(HaveLen(2))
+	})
+
+	It("should apply include and exclude globs", func() {
+		report, _ := client.DownloadDirectory(prefix, dir, &shelflib.DownloadDirectoryOptions{Include: []string{"*.txt"}, Exclude: []string{"api"}})
+		Expect(report.Transferred).To(Equal([]string{"docs/readme.txt"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"app.tar.gz": "not included", "docs/api": "excluded"}))
+	})
+
+	It("should skip files that already match", func() {
+		writeFiles(dir, map[string]string{"app.tar.gz": "app", "docs/readme.txt": "stale"})
+
+		report, _ := client.DownloadDirectory(prefix, dir, nil)
+		Expect(report.Transferred).To(Equal([]string{"docs/api/a.txt", "docs/readme.txt"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"app.tar.gz": "unchanged"}))
+		Expect(readFile("docs/readme.txt")).To(Equal("readme"))
+	})
+
+	It("should write metadata sidecars", func() {
+		server.SetMetadata("test", "builds/1.0/app.tar.gz", shelflib.CreateMetadataProperty("version", "1.0", false))
+
+		report, _ := client.DownloadDirectory(prefix, dir, &shelflib.DownloadDirectoryOptions{Include: []string{"app.tar.gz"}, Sidecar: true})
+		Expect(report.Err()).To(BeNil())
+
+		var metadata map[string]*shelflib.PropertyRecord
+		Expect(json.Unmarshal([]byte(readFile("app.tar.gz"+shelflib.SidecarSuffix)), &metadata)).To(Succeed())
+		Expect(metadata["version"]).To(Equal(&shelflib.PropertyRecord{Name: "version", Value: "1.0"}))
+
+		for _, name := range []string{"app.tar.gz", "app.tar.gz" + shelflib.SidecarSuffix} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+		}
+	})
+
+	It("should fail artifacts whose checksum does not match", func() {
+		server.PutArtifact("test", "builds/3.0/bad", []byte("content"))
+		Expect(server.SetMetadata("test", "builds/3.0/bad", shelflib.CreateMetadataProperty(shelftest.PropertySha256Hash, "0000", true))).To(BeTrue())
+
+		report, _ := client.DownloadDirectory(server.ArtifactUrl("test", "builds/3.0"), dir, &shelflib.DownloadDirectoryOptions{VerifyChecksum: true})
+		Expect(report.Failed["bad"].Code).To(Equal(shelflib.CodeChecksumMismatch))
+
+		_, err := os.Stat(filepath.Join(dir, "bad"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		entries, _ := ioutil.ReadDir(dir)
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("should fail if the prefix cannot be listed", func() {
+		_, shelfErr := server.NewShelf("WRONG").DownloadDirectory(prefix, dir, nil)
+		Expect(shelfErr).ShouldNot(BeNil())
+	})
+})
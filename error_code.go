@@ -0,0 +1,159 @@
+package shelflib
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Codes Shelf returns in the "code" field of an error response.
+const (
+	CodeBadRequest                 = "bad_request"
+	CodeInvalidRequestDataFormat   = "invalid_request_data_format"
+	CodeInvalidArtifactName        = "invalid_artifact_name"
+	CodeInvalidSearchCriteria      = "invalid_search_criteria"
+	CodeUnauthorized               = "unauthorized"
+	CodePermissionDenied           = "permission_denied"
+	CodeForbidden                  = "forbidden"
+	CodeForbiddenImmutableProperty = "forbidden_immutable_property"
+	CodeDuplicateArtifact          = "duplicate_artifact"
+	CodeResourceNotFound           = "resource_not_found"
+	CodeMethodNotAllowed           = "method_not_allowed"
+	CodeConflict                   = "conflict"
+	CodePreconditionFailed         = "precondition_failed"
+	CodeTooManyRequests            = "too_many_requests"
+	CodeInternalServerError        = "internal_server_error"
+	CodeBadGateway                 = "bad_gateway"
+	CodeServiceUnavailable         = "service_unavailable"
+	CodeGatewayTimeout             = "gateway_timeout"
+	CodeUnknownError               = "unknown_error"
+)
+
+// Codes used by shelflib itself for failures detected before
+// or after talking to Shelf.
+const (
+	CodeMissingMetadataProperty = "missing_metadata_property"
+	CodeInvalidMetadataValue    = "invalid_metadata_value"
+	CodeInvalidMetadataTarget   = "invalid_metadata_target"
+	CodeNetworkError            = "network_error"
+	CodeSymlinkNotAllowed       = "symlink_not_allowed"
+	CodeChecksumMismatch        = "checksum_mismatch"
+	CodeContentMismatch         = "content_mismatch"
+	CodeSkipDirectory           = "skip_directory"
+)
+
+// HTTP status Shelf responds with for each code.
+var codeStatusMap = map[string]int{
+	CodeBadRequest:                 http.StatusBadRequest,
+	CodeInvalidRequestDataFormat:   http.StatusBadRequest,
+	CodeInvalidArtifactName:        http.StatusBadRequest,
+	CodeInvalidSearchCriteria:      http.StatusBadRequest,
+	CodeUnauthorized:               http.StatusUnauthorized,
+	CodePermissionDenied:           http.StatusUnauthorized,
+	CodeForbidden:                  http.StatusForbidden,
+	CodeForbiddenImmutableProperty: http.StatusForbidden,
+	CodeDuplicateArtifact:          http.StatusForbidden,
+	CodeResourceNotFound:           http.StatusNotFound,
+	CodeMethodNotAllowed:           http.StatusMethodNotAllowed,
+	CodeConflict:                   http.StatusConflict,
+	CodePreconditionFailed:         http.StatusPreconditionFailed,
+	CodeTooManyRequests:            http.StatusTooManyRequests,
+	CodeInternalServerError:        http.StatusInternalServerError,
+	CodeBadGateway:                 http.StatusBadGateway,
+	CodeServiceUnavailable:         http.StatusServiceUnavailable,
+	CodeGatewayTimeout:             http.StatusGatewayTimeout,
+}
+
+// Codes worth retrying the request for.
+var retryableCodes = map[string]bool{
+	CodeTooManyRequests:     true,
+	CodeInternalServerError: true,
+	CodeBadGateway:          true,
+	CodeServiceUnavailable:  true,
+	CodeGatewayTimeout:      true,
+}
+
+// HTTP status for a code. Zero if the code is not known.
+func StatusForCode(code string) int {
+	return codeStatusMap[code]
+}
+
+// Code for an HTTP status of a response without a JSON error body.
+func CodeForStatus(status int) string {
+	if code, ok := failureResponseMap[status]; ok {
+		return code
+	}
+
+	return CodeUnknownError
+}
+
+// Finds the ShelfError in err, if any.
+func AsShelfError(err error) (*ShelfError, bool) {
+	var shelfErr *ShelfError
+
+	if !errors.As(err, &shelfErr) || shelfErr == nil {
+		return nil, false
+	}
+
+	return shelfErr, true
+}
+
+// Reports whether err is a ShelfError with one of the codes.
+func HasCode(err error, codes ...string) bool {
+	shelfErr, ok := AsShelfError(err)
+
+	if !ok {
+		return false
+	}
+
+	for _, code := range codes {
+		if shelfErr.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The artifact already exists.
+func IsDuplicate(err error) bool {
+	return HasCode(err, CodeDuplicateArtifact)
+}
+
+// An immutable metadata property was to be changed or removed.
+func IsImmutable(err error) bool {
+	return HasCode(err, CodeForbiddenImmutableProperty)
+}
+
+// The artifact, metadata property or path does not exist.
+func IsNotFound(err error) bool {
+	return HasCode(err, CodeResourceNotFound)
+}
+
+// The token was missing, invalid or not allowed to do this.
+func IsPermissionDenied(err error) bool {
+	return HasCode(err, CodePermissionDenied, CodeUnauthorized, CodeForbidden)
+}
+
+// A conditional update lost to another client.
+func IsConflict(err error) bool {
+	return HasCode(err, CodeConflict, CodePreconditionFailed)
+}
+
+// The request may succeed if it is sent again. This covers server
+// side and rate limiting failures as well as network errors.
+func IsRetryable(err error) bool {
+	var netErr net.Error
+
+	shelfErr, ok := AsShelfError(err)
+
+	if !ok {
+		return errors.As(err, &netErr)
+	}
+
+	if retryableCodes[shelfErr.Code] || retryableCodes[CodeForStatus(shelfErr.Status)] {
+		return true
+	}
+
+	return errors.As(shelfErr.Parent, &netErr)
+}
@@ -0,0 +1,69 @@
+package shelflib_test
+
+import (
+	"errors"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"net"
+	"net/http"
+)
+
+var _ = Describe("Error codes", func() {
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+	})
+
+	It("should keep Shelf's code for metadata responses", func() {
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(404, map[string]string{"message": "Not found", "code": shelflib.CodeResourceNotFound})
+		})
+		_, err := shelf.GetMetadata(uriMap["artifact"])
+		Expect(shelflib.IsNotFound(err)).To(BeTrue())
+		Expect(err.Status).To(Equal(404))
+		Expect(err.Message).To(Equal("Not found"))
+	})
+
+	It("should fall back to the status when there is no error body", func() {
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(503, "<html></html>"), nil
+		})
+		_, err := shelf.GetMetadata(uriMap["artifact"])
+		Expect(err.Code).To(Equal(shelflib.CodeServiceUnavailable))
+		Expect(shelflib.IsRetryable(err)).To(BeTrue())
+	})
+
+	DescribeTable("predicates",
+		func(code string, predicate func(error) bool) {
+			err := shelflib.CreateShelfError("Failed.", code)
+			Expect(predicate(err)).To(BeTrue())
+			Expect(predicate(shelflib.CreateShelfError("Failed.", "other"))).To(BeFalse())
+		},
+		Entry("duplicate", shelflib.CodeDuplicateArtifact, shelflib.IsDuplicate),
+		Entry("immutable", shelflib.CodeForbiddenImmutableProperty, shelflib.IsImmutable),
+		Entry("not found", shelflib.CodeResourceNotFound, shelflib.IsNotFound),
+		Entry("permission denied", shelflib.CodePermissionDenied, shelflib.IsPermissionDenied),
+		Entry("conflict", shelflib.CodeConflict, shelflib.IsConflict),
+		Entry("retryable", shelflib.CodeGatewayTimeout, shelflib.IsRetryable),
+	)
+
+	It("should treat network errors as retryable", func() {
+		err := shelflib.CreateShelfErrorFromError(&net.OpError{Op: "dial", Err: errors.New("connection refused")})
+		Expect(shelflib.IsRetryable(err)).To(BeTrue())
+		Expect(shelflib.IsRetryable(shelflib.CreateShelfErrorFromError(errors.New("bad file")))).To(BeFalse())
+	})
+
+	It("should not match a nil error", func() {
+		var err *shelflib.ShelfError
+		Expect(shelflib.IsNotFound(err)).To(BeFalse())
+		Expect(shelflib.IsRetryable(nil)).To(BeFalse())
+	})
+
+	It("should map codes to statuses", func() {
+		Expect(shelflib.StatusForCode(shelflib.CodeDuplicateArtifact)).To(Equal(403))
+		Expect(shelflib.StatusForCode(shelflib.CodeResourceNotFound)).To(Equal(404))
+		Expect(shelflib.CodeForStatus(418)).To(Equal(shelflib.CodeUnknownError))
+	})
+})
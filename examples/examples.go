@@ -7,7 +7,10 @@ import (
 	"math/rand"
 	"time"
     "github.com/not-nexus/shelf-lib-go"
+    "github.com/not-nexus/shelf-lib-go/shelfcassette"
     "log"
+    "log/slog"
+    "net/http"
     "os"
     "path/filepath"
 )
@@ -48,7 +51,11 @@ func main() {
             -v --verbose            Verbose logging.
 
             --shelf-token <token>   Shelf token. Required if token not set in
-                                    then environment as SHELF_AUTH_TOKEN.
+                                    then environment as SHELF_AUTH_TOKEN or
+                                    in ~/.config/shelf.
+
+            --record <file>         Record the requests made to a cassette
+                                    that tests can replay.
 
         Arguments:
             <host>                  Host of Shelf to point to.
@@ -61,26 +68,52 @@ func main() {
     refName := arguments["<refName>"].(string)
     path := arguments["<path>"].(string)
     host := arguments["<host>"].(string)
-    shelfToken := os.Getenv("SHELF_AUTH_TOKEN")
-
-    if shelfToken == "" {
-        if val, ok := arguments["--shelf-token"]; ok {
-            shelfToken = val.(string)
-        } else {
-            fmt.Println("Must supply a shelf token via the command line or environment variable.")
-            os.Exit(1)
-        }
+    overrides := &shelflib.Config{Host: host, Bucket: refName}
+
+    if val, ok := arguments["--shelf-token"].(string); ok {
+        overrides.Token = val
+    }
+
+    config, err := shelflib.LoadConfig(overrides)
+    checkError("Error loading config.", err)
+
+    if config.Token == "" && config.TokenFile == "" {
+        fmt.Println("Must supply a shelf token via the command line, environment variable or config.")
+        os.Exit(1)
     }
 
     logger := log.New(os.Stderr, "", 0)
-    shelfLib := shelflib.New(shelfToken, logger)
+    shelfLib := shelflib.NewFromConfig(config, logger)
+
+    if verbose, _ := arguments["--verbose"].(bool); verbose {
+        shelfLib.LogLevel.Set(slog.LevelInfo)
+    }
+
+    if cassettePath, ok := arguments["--record"].(string); ok {
+        client := shelfLib.Request.Client
+
+        if client == nil {
+            client = &http.Client{}
+        }
+
+        recorder := shelfcassette.New(cassettePath, shelfcassette.ModeRecord)
+        recorder.Transport = client.Transport
+        client.Transport = recorder
+        shelfLib.Request.Client = client
+
+        defer func() {
+            if saveErr := recorder.Save(); saveErr != nil {
+                os.Stderr.WriteString("Error saving cassette.\n" + saveErr.Error() + "\n")
+            }
+        }()
+    }
     wd, _ := os.Getwd()
     dir, _ := filepath.Abs(filepath.Dir(wd))
 
     // Let's just use the repositories README.md for our test.
     filePath := filepath.Join(dir, "shelf-lib-go", "README.md")
 
-    basePath := host + refName + "/artifact/" + path
+    basePath := config.ArtifactUrl(path)
     artifactPath := basePath + "/" + randomString(32)
     fmt.Println("Creating artifact with path: " + artifactPath + " with " + filePath)
     //err := shelfLib.UploadArtifactFromFile(artifactPath, filePath)
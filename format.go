@@ -0,0 +1,345 @@
+package shelflib
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/tomnomnom/linkheader"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// Names of the output formats NewFormatter accepts.
+const (
+	FormatJson      = "json"
+	FormatJsonLines = "jsonl"
+	FormatCsv       = "csv"
+	FormatTable     = "table"
+	FormatTemplate  = "template"
+)
+
+var Formats = []string{FormatJson, FormatJsonLines, FormatCsv, FormatTable, FormatTemplate}
+
+// JSON schema of an ArtifactRecord as it is output in JSON
+// and JSON Lines. The schema is versioned by its $id.
+//
+//go:embed schema/artifact.schema.json
+var ArtifactSchema string
+
+// An artifact or directory from a listing or search, optionally
+// with its metadata. Marshals to JSON as described by ArtifactSchema.
+type ArtifactRecord struct {
+	Path     string                     `json:"path"`
+	Url      string                     `json:"url"`
+	Rel      string                     `json:"rel,omitempty"`
+	Title    string                     `json:"title"`
+	Metadata map[string]*PropertyRecord `json:"metadata,omitempty"`
+}
+
+// A metadata property as it is output by formatters.
+type PropertyRecord struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Immutable bool   `json:"immutable"`
+}
+
+// Writes listing, search and metadata results.
+type Formatter interface {
+	Artifacts(writer io.Writer, records []*ArtifactRecord) error
+	Metadata(writer io.Writer, records []*PropertyRecord) error
+}
+
+type FormatOptions struct {
+	// Metadata properties shown as columns by the csv and table
+	// formats. Defaults to every property of the artifacts.
+	Columns []string
+	// Template for the template format. Executed once per record.
+	Template string
+}
+
+// Create a Formatter for one of Formats. opts may be nil.
+func NewFormatter(format string, opts *FormatOptions) (Formatter, *ShelfError) {
+	if opts == nil {
+		opts = &FormatOptions{}
+	}
+
+	switch format {
+	case FormatJson:
+		return &jsonFormatter{}, nil
+	case FormatJsonLines:
+		return &jsonFormatter{lines: true}, nil
+	case FormatCsv, FormatTable:
+		return &tableFormatter{csv: format == FormatCsv, columns: opts.Columns}, nil
+	case FormatTemplate:
+		if opts.Template == "" {
+			return nil, CreateShelfError("The template format needs a template.", CodeBadRequest)
+		}
+
+		parsed, err := template.New("record").Parse(opts.Template)
+
+		if err != nil {
+			shelfErr := CreateShelfError("Invalid template: "+err.Error(), CodeBadRequest)
+			shelfErr.Parent = err
+
+			return nil, shelfErr
+		}
+
+		return &templateFormatter{template: parsed}, nil
+	}
+
+	return nil, CreateShelfError("Unknown format "+format+", expected one of "+strings.Join(Formats, ", ")+".", CodeBadRequest)
+}
+
+// Records for the links returned by ListArtifact or Search.
+// Links are resolved against base, the URL that was requested.
+// The metadata link ListArtifact returns for an artifact is skipped.
+func NewArtifactRecords(base string, links linkheader.Links) ([]*ArtifactRecord, *ShelfError) {
+	records := make([]*ArtifactRecord, 0, len(links))
+
+	for _, link := range links {
+		if link.Params["title"] == "metadata" {
+			continue
+		}
+
+		linkUrl, shelfErr := ResolveLinkUrl(base, link)
+
+		if shelfErr != nil {
+			return records, shelfErr
+		}
+
+		path := link.URL
+
+		if index := strings.Index(path, "/artifact/"); index >= 0 {
+			path = path[index+len("/artifact/"):]
+		}
+
+		records = append(records, &ArtifactRecord{Path: path, Url: linkUrl, Rel: link.Rel, Title: link.Params["title"]})
+	}
+
+	return records, nil
+}
+
+// Records for metadata, sorted by name.
+func NewPropertyRecords(metadata map[string]*MetadataProperty) []*PropertyRecord {
+	records := make([]*PropertyRecord, 0, len(metadata))
+
+	for name, prop := range metadata {
+		records = append(records, &PropertyRecord{Name: name, Value: prop.Value, Immutable: prop.Immutable})
+	}
+
+	sort.Slice(records, func(i int, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+
+	return records
+}
+
+// Fetches the metadata of every artifact record. Directories are skipped.
+func (this *ShelfLib) AddMetadata(records []*ArtifactRecord) *ShelfError {
+	shelfLib, end := this.operation("AddMetadata")
+	defer end()
+
+	for _, record := range records {
+		if record.Title == "directory" || strings.HasSuffix(record.Path, "/") {
+			continue
+		}
+
+		metadata, shelfErr := shelfLib.GetMetadata(record.Url)
+
+		if shelfErr != nil {
+			return shelfErr
+		}
+
+		record.Metadata = make(map[string]*PropertyRecord)
+
+		for _, prop := range NewPropertyRecords(metadata) {
+			record.Metadata[prop.Name] = prop
+		}
+	}
+
+	return nil
+}
+
+// Writes records as a JSON array, or one JSON object per line.
+type jsonFormatter struct {
+	lines bool
+}
+
+func (this *jsonFormatter) Artifacts(writer io.Writer, records []*ArtifactRecord) error {
+	values := make([]interface{}, len(records))
+
+	for i, record := range records {
+		values[i] = record
+	}
+
+	return this.write(writer, values)
+}
+
+func (this *jsonFormatter) Metadata(writer io.Writer, records []*PropertyRecord) error {
+	values := make([]interface{}, len(records))
+
+	for i, record := range records {
+		values[i] = record
+	}
+
+	return this.write(writer, values)
+}
+
+func (this *jsonFormatter) write(writer io.Writer, values []interface{}) error {
+	encoder := json.NewEncoder(writer)
+
+	if !this.lines {
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(values)
+	}
+
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes records as CSV with a header, or as a table with
+// aligned columns. Metadata properties become columns.
+type tableFormatter struct {
+	csv     bool
+	columns []string
+}
+
+func (this *tableFormatter) Artifacts(writer io.Writer, records []*ArtifactRecord) error {
+	columns := this.columns
+
+	if columns == nil {
+		columns = metadataColumns(records)
+	}
+
+	header := []string{"path", "title"}
+
+	if this.csv {
+		header = []string{"path", "url", "title"}
+	}
+
+	header = append(header, columns...)
+	rows := make([][]string, 0, len(records))
+
+	for _, record := range records {
+		row := []string{record.Path, record.Title}
+
+		if this.csv {
+			row = []string{record.Path, record.Url, record.Title}
+		}
+
+		for _, column := range columns {
+			value := ""
+
+			if prop, ok := record.Metadata[column]; ok {
+				value = prop.Value
+			}
+
+			row = append(row, value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return this.write(writer, header, rows)
+}
+
+func (this *tableFormatter) Metadata(writer io.Writer, records []*PropertyRecord) error {
+	rows := make([][]string, 0, len(records))
+
+	for _, record := range records {
+		rows = append(rows, []string{record.Name, record.Value, strconv.FormatBool(record.Immutable)})
+	}
+
+	return this.write(writer, []string{"name", "value", "immutable"}, rows)
+}
+
+func (this *tableFormatter) write(writer io.Writer, header []string, rows [][]string) error {
+	if this.csv {
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(header)
+		csvWriter.WriteAll(rows)
+
+		return csvWriter.Error()
+	}
+
+	tableWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tableWriter, strings.ToUpper(strings.Join(header, "\t")))
+
+	for _, row := range rows {
+		fmt.Fprintln(tableWriter, strings.Join(row, "\t"))
+	}
+
+	return tableWriter.Flush()
+}
+
+// Names of the metadata properties of any of the records, sorted.
+func metadataColumns(records []*ArtifactRecord) []string {
+	seen := make(map[string]bool)
+	columns := make([]string, 0)
+
+	for _, record := range records {
+		for name := range record.Metadata {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+
+	sort.Strings(columns)
+
+	return columns
+}
+
+// Executes a template for every record. A newline is
+// added after each unless the template ends with one.
+type templateFormatter struct {
+	template *template.Template
+}
+
+func (this *templateFormatter) Artifacts(writer io.Writer, records []*ArtifactRecord) error {
+	for _, record := range records {
+		if err := this.execute(writer, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (this *templateFormatter) Metadata(writer io.Writer, records []*PropertyRecord) error {
+	for _, record := range records {
+		if err := this.execute(writer, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (this *templateFormatter) execute(writer io.Writer, record interface{}) error {
+	var output strings.Builder
+
+	if err := this.template.Execute(&output, record); err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(output.String(), "\n") {
+		output.WriteString("\n")
+	}
+
+	_, err := io.WriteString(writer, output.String())
+
+	return err
+}
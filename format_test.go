@@ -0,0 +1,182 @@
+package shelflib_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tomnomnom/linkheader"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var _ = Describe("Formatters", func() {
+	var (
+		records []*shelflib.ArtifactRecord
+		output  *bytes.Buffer
+	)
+
+	format := func(name string, opts *shelflib.FormatOptions) string {
+		formatter, shelfErr := shelflib.NewFormatter(name, opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(formatter.Artifacts(output, records)).To(Succeed())
+
+		return output.String()
+	}
+
+	BeforeEach(func() {
+		output = new(bytes.Buffer)
+		records = []*shelflib.ArtifactRecord{
+			{
+				Path:  "dir/a",
+				Url:   "https://shelf/test/artifact/dir/a",
+				Rel:   "item",
+				Title: "artifact",
+				Metadata: map[string]*shelflib.PropertyRecord{
+					"version": {Name: "version", Value: "1.0", Immutable: false},
+				},
+			},
+			{Path: "dir/sub/", Url: "https://shelf/test/artifact/dir/sub/", Rel: "item", Title: "directory"},
+		}
+	})
+
+	Context("NewArtifactRecords", func() {
+		It("should resolve links and skip the metadata link", func() {
+			links := linkheader.Parse(testLink + ", " + metadataLink)
+			records, shelfErr := shelflib.NewArtifactRecords(uriMap["artifact"], links)
+			Expect(shelfErr).To(BeNil())
+			Expect(records).To(Equal([]*shelflib.ArtifactRecord{{
+				Path:  "thing",
+				Url:   host + "test/artifact/thing",
+				Rel:   "self",
+				Title: "artifact",
+			}}))
+		})
+	})
+
+	It("should sort property records by name", func() {
+		records := shelflib.NewPropertyRecords(map[string]*shelflib.MetadataProperty{
+			"version": shelflib.CreateMetadataProperty("version", "1", false),
+			"build":   shelflib.CreateMetadataProperty("build", "2", true),
+		})
+		Expect(records).To(Equal([]*shelflib.PropertyRecord{
+			{Name: "build", Value: "2", Immutable: true},
+			{Name: "version", Value: "1", Immutable: false},
+		}))
+	})
+
+	It("should format JSON", func() {
+		var decoded []map[string]interface{}
+
+		Expect(json.Unmarshal([]byte(format(shelflib.FormatJson, nil)), &decoded)).To(Succeed())
+		Expect(decoded).To(HaveLen(2))
+		Expect(decoded[0]["metadata"]).To(Equal(map[string]interface{}{
+			"version": map[string]interface{}{"name": "version", "value": "1.0", "immutable": false},
+		}))
+		Expect(decoded[1]).ShouldNot(HaveKey("metadata"))
+	})
+
+	It("should format JSON Lines", func() {
+		lines := strings.Split(strings.TrimSpace(format(shelflib.FormatJsonLines, nil)), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[1]).To(Equal(`{"path":"dir/sub/","url":"https://shelf/test/artifact/dir/sub/","rel":"item","title":"directory"}`))
+	})
+
+	It("should format CSV with metadata columns", func() {
+		Expect(format(shelflib.FormatCsv, nil)).To(Equal(
+			"path,url,title,version\n" +
+				"dir/a,https://shelf/test/artifact/dir/a,artifact,1.0\n" +
+				"dir/sub/,https://shelf/test/artifact/dir/sub/,directory,\n"))
+	})
+
+	It("should format an aligned table of the given columns", func() {
+		Expect(format(shelflib.FormatTable, &shelflib.FormatOptions{Columns: []string{"build"}})).To(Equal(
+			"PATH      TITLE      BUILD\n" +
+				"dir/a     artifact   \n" +
+				"dir/sub/  directory  \n"))
+	})
+
+	It("should format metadata", func() {
+		formatter, _ := shelflib.NewFormatter(shelflib.FormatTable, nil)
+		Expect(formatter.Metadata(output, []*shelflib.PropertyRecord{{Name: "version", Value: "1", Immutable: true}})).To(Succeed())
+		Expect(output.String()).To(Equal("NAME     VALUE  IMMUTABLE\nversion  1      true\n"))
+	})
+
+	It("should execute a template per record", func() {
+		opts := &shelflib.FormatOptions{Template: `{{.Path}} {{with index .Metadata "version"}}{{.Value}}{{end}}`}
+		Expect(format(shelflib.FormatTemplate, opts)).To(Equal("dir/a 1.0\ndir/sub/ \n"))
+	})
+
+	It("should reject unknown formats and bad templates", func() {
+		_, shelfErr := shelflib.NewFormatter("xml", nil)
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeBadRequest))
+
+		_, shelfErr = shelflib.NewFormatter(shelflib.FormatTemplate, nil)
+		Expect(shelfErr).ShouldNot(BeNil())
+
+		_, shelfErr = shelflib.NewFormatter(shelflib.FormatTemplate, &shelflib.FormatOptions{Template: "{{.Path"})
+		Expect(shelfErr).ShouldNot(BeNil())
+	})
+
+	It("should describe records in the schema", func() {
+		var schema struct {
+			Required   []string
+			Properties map[string]interface{}
+			Defs       map[string]struct {
+				Required []string
+			} `json:"$defs"`
+		}
+
+		Expect(json.Unmarshal([]byte(shelflib.ArtifactSchema), &schema)).To(Succeed())
+		Expect(jsonNames(reflect.TypeOf(shelflib.ArtifactRecord{}))).To(ConsistOf(keys(schema.Properties)))
+		Expect(jsonNames(reflect.TypeOf(shelflib.PropertyRecord{}))).To(ConsistOf(schema.Defs["property"].Required))
+		Expect(schema.Required).To(ConsistOf("path", "url", "title"))
+	})
+
+	Context("AddMetadata", func() {
+		BeforeEach(func() {
+			shelf = shelflib.New(validToken, logger)
+			httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+				return httpmock.NewJsonResponse(200, testMetadata)
+			})
+		})
+
+		It("should fetch metadata for artifacts only", func() {
+			records := []*shelflib.ArtifactRecord{
+				{Path: testPath, Url: uriMap["artifact"], Title: "artifact"},
+				{Path: "dir/", Url: host + "test/artifact/dir/", Title: "directory"},
+			}
+
+			Expect(shelf.AddMetadata(records)).To(BeNil())
+			Expect(records[0].Metadata).To(HaveKeyWithValue("build", &shelflib.PropertyRecord{Name: "build", Value: "10"}))
+			Expect(records[1].Metadata).To(BeNil())
+		})
+	})
+})
+
+// Names fields of t marshal to.
+func jsonNames(t reflect.Type) []string {
+	names := make([]string, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+
+	return names
+}
+
+func keys(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,185 @@
+package shelflib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Replaces secrets in logged URLs and headers.
+const redacted = "REDACTED"
+
+// Query parameters that are redacted from logged URLs.
+var sensitiveParams = []string{"token", "key", "secret", "password", "signature", "auth"}
+
+// Adapts a *log.Logger to slog. Records below level are dropped,
+// as is everything when logger is nil or has no output.
+func NewLogHandler(logger *log.Logger, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+
+	return &logHandler{
+		logger: logger,
+		level:  level,
+		text: slog.NewTextHandler(&logWriter{logger: logger}, &slog.HandlerOptions{
+			// log.Logger cannot be told who called it, so
+			// the source is logged as an attribute instead.
+			AddSource: logger != nil && logger.Flags()&(log.Lshortfile|log.Llongfile) != 0,
+			Level:     level,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				// *log.Logger adds its own timestamp if it wants one.
+				if len(groups) == 0 && attr.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+
+				return attr
+			},
+		}),
+	}
+}
+
+type logHandler struct {
+	logger *log.Logger
+	level  slog.Leveler
+	text   slog.Handler
+}
+
+func (this *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return this.logger != nil && this.logger.Writer() != nil && this.text.Enabled(ctx, level)
+}
+
+func (this *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	return this.text.Handle(ctx, record)
+}
+
+func (this *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{logger: this.logger, level: this.level, text: this.text.WithAttrs(attrs)}
+}
+
+func (this *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{logger: this.logger, level: this.level, text: this.text.WithGroup(name)}
+}
+
+// Writes each formatted record as one log.Logger entry.
+type logWriter struct {
+	logger *log.Logger
+}
+
+func (this *logWriter) Write(data []byte) (int, error) {
+	// There is no caller of the logger to report, see AddSource.
+	err := this.logger.Output(0, strings.TrimSuffix(string(data), "\n"))
+
+	return len(data), err
+}
+
+// Logs every request that passes through it. Successful requests are
+// logged at info, Shelf error responses at warn and failures to send
+// at error. Headers are logged at debug with Authorization redacted.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(request *http.Request) (*http.Response, error) {
+			ctx := request.Context()
+			start := time.Now()
+			response, err := next.Do(request)
+			attrs := []slog.Attr{
+				slog.String("method", request.Method),
+				slog.String("url", RedactUrl(request.URL)),
+				slog.Int("attempt", AttemptFromContext(ctx)),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int64("request_bytes", request.ContentLength),
+			}
+
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				attrs = append(attrs, slog.Any("headers", RedactHeaders(request.Header)))
+			}
+
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+				logger.LogAttrs(ctx, slog.LevelError, "shelf request failed", attrs...)
+
+				return response, err
+			}
+
+			attrs = append(attrs, slog.Int("status", response.StatusCode), slog.Int64("response_bytes", response.ContentLength))
+			level := slog.LevelInfo
+
+			if response.StatusCode >= 400 {
+				level = slog.LevelWarn
+
+				if logger.Enabled(ctx, level) {
+					attrs = append(attrs, slog.String("code", peekErrorCode(response)))
+				}
+			}
+
+			logger.LogAttrs(ctx, level, "shelf request", attrs...)
+
+			return response, err
+		})
+	}
+}
+
+// URL safe to log. User info and sensitive query parameters are removed.
+func RedactUrl(requestUrl *url.URL) string {
+	redactedUrl := *requestUrl
+
+	if redactedUrl.User != nil {
+		redactedUrl.User = url.User(redacted)
+	}
+
+	query := redactedUrl.Query()
+
+	for key := range query {
+		for _, sensitive := range sensitiveParams {
+			if strings.Contains(strings.ToLower(key), sensitive) {
+				query.Set(key, redacted)
+			}
+		}
+	}
+
+	redactedUrl.RawQuery = query.Encode()
+
+	return redactedUrl.String()
+}
+
+// Copy of the headers safe to log.
+func RedactHeaders(header http.Header) http.Header {
+	copied := header.Clone()
+
+	for _, key := range []string{"Authorization", "Cookie", "Proxy-Authorization"} {
+		if _, ok := copied[key]; ok {
+			copied.Set(key, redacted)
+		}
+	}
+
+	return copied
+}
+
+// Reads the Shelf error code from an error response
+// and puts the body back for the caller.
+func peekErrorCode(response *http.Response) string {
+	var parsedBody struct {
+		Code string `json:"code"`
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err == nil {
+		err = json.Unmarshal(body, &parsedBody)
+	}
+
+	if err != nil || parsedBody.Code == "" {
+		return CodeForStatus(response.StatusCode)
+	}
+
+	return parsedBody.Code
+}
@@ -0,0 +1,261 @@
+package shelflib
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Struct tag used to map fields to metadata properties.
+// For example `shelf:"version,immutable"`. Supported options
+// are "immutable" and "omitempty". Untagged fields are ignored.
+const MetadataTag = "shelf"
+
+// Describes a struct field tagged for metadata.
+type metadataField struct {
+	index     int
+	name      string
+	immutable bool
+	omitEmpty bool
+}
+
+// Retrieve metadata for an artifact and decode it into
+// the struct v points to.
+func (this *ShelfLib) GetMetadataInto(path string, v interface{}) *ShelfError {
+	metadata, err := this.GetMetadata(path)
+
+	if err != nil {
+		return err
+	}
+
+	return DecodeMetadata(metadata, v)
+}
+
+// Encode the struct v and bulk update an artifact's metadata with it.
+func (this *ShelfLib) UpdateMetadataFrom(path string, v interface{}) (map[string]*MetadataProperty, *ShelfError) {
+	metadata, err := EncodeMetadata(v)
+
+	if err != nil {
+		return metadata, err
+	}
+
+	return this.UpdateMetadata(path, metadata)
+}
+
+// Decodes metadata into the struct v points to. Properties are
+// converted from strings to the type of the tagged field. Fields
+// without "omitempty" must have a property.
+func DecodeMetadata(metadata map[string]*MetadataProperty, v interface{}) *ShelfError {
+	var shelfErr *ShelfError
+
+	value := reflect.ValueOf(v)
+
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		shelfErr = CreateShelfError("Metadata can only be decoded into a pointer to a struct.", CodeInvalidMetadataTarget)
+
+		return shelfErr
+	}
+
+	value = value.Elem()
+
+	for _, field := range metadataFields(value.Type()) {
+		prop := metadata[field.name]
+
+		if prop == nil {
+			if field.omitEmpty {
+				continue
+			}
+
+			message := fmt.Sprintf("Metadata property %q is missing.", field.name)
+			shelfErr = CreateShelfError(message, CodeMissingMetadataProperty)
+
+			return shelfErr
+		}
+
+		fieldValue := value.Field(field.index)
+		err := setMetadataValue(fieldValue, prop.Value)
+
+		if err != nil {
+			message := fmt.Sprintf("Metadata property %q value %q could not be converted to %s: %s", field.name, prop.Value, fieldValue.Type(), err)
+			shelfErr = CreateShelfError(message, CodeInvalidMetadataValue)
+			shelfErr.Parent = err
+
+			return shelfErr
+		}
+	}
+
+	return shelfErr
+}
+
+// Encodes the struct v, or a pointer to it, as metadata.
+// Values are converted to the strings Shelf stores.
+func EncodeMetadata(v interface{}) (map[string]*MetadataProperty, *ShelfError) {
+	var shelfErr *ShelfError
+
+	metadata := make(map[string]*MetadataProperty)
+	value := reflect.ValueOf(v)
+
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		shelfErr = CreateShelfError("Metadata can only be encoded from a struct.", CodeInvalidMetadataTarget)
+
+		return metadata, shelfErr
+	}
+
+	for _, field := range metadataFields(value.Type()) {
+		fieldValue := value.Field(field.index)
+
+		if field.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+
+		if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
+			continue
+		}
+
+		str, err := getMetadataValue(fieldValue)
+
+		if err != nil {
+			message := fmt.Sprintf("Field for metadata property %q could not be converted to a string: %s", field.name, err)
+			shelfErr = CreateShelfError(message, CodeInvalidMetadataValue)
+			shelfErr.Parent = err
+
+			return metadata, shelfErr
+		}
+
+		metadata[field.name] = CreateMetadataProperty(field.name, str, field.immutable)
+	}
+
+	return metadata, shelfErr
+}
+
+// Finds the fields of a struct tagged for metadata.
+func metadataFields(structType reflect.Type) []metadataField {
+	fields := make([]metadataField, 0)
+
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		tag, ok := structField.Tag.Lookup(MetadataTag)
+
+		if !ok || tag == "-" || structField.PkgPath != "" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		field := metadataField{index: i, name: options[0]}
+
+		if field.name == "" {
+			field.name = structField.Name
+		}
+
+		for _, option := range options[1:] {
+			switch option {
+			case "immutable":
+				field.immutable = true
+			case "omitempty":
+				field.omitEmpty = true
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// Parses a metadata string into a field. Types implementing
+// encoding.TextUnmarshaler, such as time.Time, are supported.
+func setMetadataValue(field reflect.Value, str string) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+
+		return setMetadataValue(field.Elem(), str)
+	}
+
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(str))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(str)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(str)
+
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(str, 10, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(str, 10, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(str, field.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// Formats a field as a metadata string. Types implementing
+// encoding.TextMarshaler, such as time.Time, are supported.
+func getMetadataValue(field reflect.Value) (string, error) {
+	if field.Kind() == reflect.Ptr {
+		return getMetadataValue(field.Elem())
+	}
+
+	if field.CanAddr() {
+		field = field.Addr()
+	}
+
+	if marshaler, ok := field.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+
+		return string(text), err
+	}
+
+	field = reflect.Indirect(field)
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'f', -1, field.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", field.Type())
+}
@@ -0,0 +1,94 @@
+package shelflib_test
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+type buildMetadata struct {
+	Version  *semver.Version `shelf:"version"`
+	Build    int             `shelf:"build"`
+	GitSha   string          `shelf:"git_sha,immutable,omitempty"`
+	Released time.Time       `shelf:"released,omitempty"`
+	Stable   bool            `shelf:"stable,omitempty"`
+	Ignored  string
+}
+
+var _ = Describe("Metadata codec", func() {
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, testMetadata)
+		})
+	})
+
+	Context("GetMetadataInto", func() {
+		It("should decode metadata into a struct", func() {
+			result := &buildMetadata{}
+			err := shelf.GetMetadataInto(uriMap["artifact"], result)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(result.Version.String()).To(Equal("1.5.0"))
+			Expect(result.Build).To(Equal(10))
+			Expect(result.GitSha).To(Equal(""))
+		})
+	})
+
+	Context("UpdateMetadataFrom", func() {
+		It("should encode a struct as metadata", func() {
+			var sent map[string]map[string]interface{}
+			httpmock.RegisterResponder("PUT", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+				Expect(readJson(request, &sent)).ShouldNot(HaveOccurred())
+
+				return httpmock.NewJsonResponse(200, testMetadata)
+			})
+
+			released := time.Date(2017, 3, 4, 12, 0, 0, 0, time.UTC)
+			source := buildMetadata{Version: semver.MustParse("1.5.0"), Build: 10, GitSha: "abc123", Released: released}
+			_, err := shelf.UpdateMetadataFrom(uriMap["artifact"], source)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(sent).To(HaveLen(4))
+			Expect(sent["version"]["value"]).To(Equal("1.5.0"))
+			Expect(sent["build"]["value"]).To(Equal("10"))
+			Expect(sent["git_sha"]["immutable"]).To(BeTrue())
+			Expect(sent["released"]["value"]).To(Equal("2017-03-04T12:00:00Z"))
+		})
+	})
+
+	Context("DecodeMetadata", func() {
+		It("should fail for missing properties", func() {
+			metadata := map[string]*shelflib.MetadataProperty{
+				"version": shelflib.CreateMetadataProperty("version", "1.5", false),
+			}
+			err := shelflib.DecodeMetadata(metadata, &buildMetadata{})
+			Expect(err.Code).To(Equal("missing_metadata_property"))
+			Expect(err.Message).To(ContainSubstring(`"build"`))
+		})
+		It("should treat nil properties as missing", func() {
+			metadata := map[string]*shelflib.MetadataProperty{
+				"version": shelflib.CreateMetadataProperty("version", "1.5", false),
+				"build":   nil,
+			}
+			err := shelflib.DecodeMetadata(metadata, &buildMetadata{})
+			Expect(err.Code).To(Equal("missing_metadata_property"))
+		})
+		It("should fail for unparsable properties", func() {
+			metadata := map[string]*shelflib.MetadataProperty{
+				"version": shelflib.CreateMetadataProperty("version", "1.5", false),
+				"build":   shelflib.CreateMetadataProperty("build", "ten", false),
+			}
+			err := shelflib.DecodeMetadata(metadata, &buildMetadata{})
+			Expect(err.Code).To(Equal("invalid_metadata_value"))
+			Expect(err.Message).To(ContainSubstring(`"ten"`))
+		})
+		It("should require a pointer to a struct", func() {
+			err := shelflib.DecodeMetadata(nil, buildMetadata{})
+			Expect(err.Code).To(Equal("invalid_metadata_target"))
+		})
+	})
+})
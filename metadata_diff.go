@@ -0,0 +1,205 @@
+package shelflib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type MetadataAction string
+
+const (
+	MetadataAdd               MetadataAction = "add"
+	MetadataChange            MetadataAction = "change"
+	MetadataRemove            MetadataAction = "remove"
+	MetadataImmutableConflict MetadataAction = "immutable_conflict"
+)
+
+// A difference between an artifact's current and desired metadata.
+type MetadataDiffEntry struct {
+	Name    string
+	Action  MetadataAction
+	Current *MetadataProperty
+	Desired *MetadataProperty
+}
+
+// Options for ApplyMetadata.
+type ApplyMetadataOptions struct {
+	// Remove properties that are not in the desired metadata.
+	Prune bool
+	// Print the plan instead of making changes.
+	DryRun bool
+	// Where the plan is printed on a dry run. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// Result of ApplyMetadata.
+type MetadataReport struct {
+	DryRun bool
+	// Every entry of the diff that was acted on, or would have been on a dry run.
+	Plan    []*MetadataDiffEntry
+	Applied []*MetadataDiffEntry
+	// Properties that could not be applied, including immutable conflicts.
+	Failed map[string]*ShelfError
+}
+
+// Nil if nothing failed, otherwise the failure of the
+// first property of the plan that failed.
+func (this *MetadataReport) Err() *ShelfError {
+	for _, entry := range this.Plan {
+		if failed, ok := this.Failed[entry.Name]; ok {
+			return failed
+		}
+	}
+
+	return nil
+}
+
+// Formats the entry as a line of a plan.
+func (this *MetadataDiffEntry) String() string {
+	switch this.Action {
+	case MetadataAdd:
+		return fmt.Sprintf("add %s = %q%s", this.Name, this.Desired.Value, immutableSuffix(this.Desired))
+	case MetadataChange:
+		return fmt.Sprintf("change %s = %q -> %q%s", this.Name, this.Current.Value, this.Desired.Value, immutableSuffix(this.Desired))
+	case MetadataRemove:
+		return fmt.Sprintf("remove %s = %q", this.Name, this.Current.Value)
+	}
+
+	return fmt.Sprintf("conflict %s is immutable", this.Name)
+}
+
+// Classifies each key of the current and desired metadata. Keys that
+// are the same on both sides are left out, nil values count as absent.
+// Entries are sorted by name.
+func ComputeMetadataDiff(current map[string]*MetadataProperty, desired map[string]*MetadataProperty) []*MetadataDiffEntry {
+	diff := make([]*MetadataDiffEntry, 0)
+
+	for name, desiredProp := range desired {
+		if desiredProp == nil {
+			continue
+		}
+
+		currentProp := current[name]
+		entry := &MetadataDiffEntry{Name: name, Current: currentProp, Desired: desiredProp}
+
+		if currentProp == nil {
+			entry.Action = MetadataAdd
+		} else if currentProp.Value == desiredProp.Value && currentProp.Immutable == desiredProp.Immutable {
+			continue
+		} else if currentProp.Immutable {
+			// Shelf will refuse to change the value and
+			// will not make a property mutable again.
+			if currentProp.Value == desiredProp.Value {
+				continue
+			}
+
+			entry.Action = MetadataImmutableConflict
+		} else {
+			entry.Action = MetadataChange
+		}
+
+		diff = append(diff, entry)
+	}
+
+	for name, currentProp := range current {
+		if currentProp == nil || desired[name] != nil {
+			continue
+		}
+
+		entry := &MetadataDiffEntry{Name: name, Current: currentProp, Action: MetadataRemove}
+
+		if currentProp.Immutable {
+			entry.Action = MetadataImmutableConflict
+		}
+
+		diff = append(diff, entry)
+	}
+
+	sort.Slice(diff, func(i int, j int) bool {
+		return diff[i].Name < diff[j].Name
+	})
+
+	return diff
+}
+
+// Brings an artifact's metadata to the desired state with the fewest
+// requests. Properties are only removed when opts.Prune is set.
+// If any property fails, the report is returned with the failure
+// of the first one, see MetadataReport.Err.
+func (this *ShelfLib) ApplyMetadata(path string, desired map[string]*MetadataProperty, opts *ApplyMetadataOptions) (*MetadataReport, *ShelfError) {
+	shelfLib, end := this.operation("ApplyMetadata")
+	defer end()
+
+	if opts == nil {
+		opts = &ApplyMetadataOptions{}
+	}
+
+	report := &MetadataReport{DryRun: opts.DryRun, Failed: make(map[string]*ShelfError)}
+
+	current, err := shelfLib.GetMetadata(path)
+
+	if err != nil {
+		return report, err
+	}
+
+	named := make(map[string]*MetadataProperty)
+
+	for name, prop := range desired {
+		if prop != nil {
+			named[name] = CreateMetadataProperty(name, prop.Value, prop.Immutable)
+		}
+	}
+
+	for _, entry := range ComputeMetadataDiff(current, named) {
+		if entry.Desired == nil && !opts.Prune {
+			continue
+		}
+
+		report.Plan = append(report.Plan, entry)
+	}
+
+	if opts.DryRun {
+		output := opts.Output
+
+		if output == nil {
+			output = os.Stdout
+		}
+
+		for _, entry := range report.Plan {
+			fmt.Fprintln(output, entry)
+		}
+
+		return report, nil
+	}
+
+	for _, entry := range report.Plan {
+		switch entry.Action {
+		case MetadataAdd:
+			_, err = shelfLib.CreateMetadataProperty(path, entry.Desired)
+		case MetadataChange:
+			_, err = shelfLib.UpdateMetadataProperty(path, entry.Desired)
+		case MetadataRemove:
+			err = shelfLib.DeleteMetadataProperty(path, entry.Name)
+		case MetadataImmutableConflict:
+			err = CreateShelfError("Metadata property "+entry.Name+" is immutable.", CodeForbiddenImmutableProperty)
+		}
+
+		if err != nil {
+			report.Failed[entry.Name] = err
+		} else {
+			report.Applied = append(report.Applied, entry)
+		}
+	}
+
+	return report, report.Err()
+}
+
+func immutableSuffix(prop *MetadataProperty) string {
+	if prop.Immutable {
+		return " (immutable)"
+	}
+
+	return ""
+}
@@ -0,0 +1,108 @@
+package shelflib_test
+
+import (
+	"bytes"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+)
+
+var _ = Describe("Metadata diff", func() {
+	var (
+		calls   []string
+		current = map[string]*shelflib.MetadataProperty{
+			"version": shelflib.CreateMetadataProperty("version", "1.5", false),
+			"build":   shelflib.CreateMetadataProperty("build", "10", false),
+			"md5Hash": shelflib.CreateMetadataProperty("md5Hash", "abc", true),
+		}
+		desired = map[string]*shelflib.MetadataProperty{
+			"version": {Value: "1.6"},
+			"md5Hash": {Value: "def", Immutable: true},
+			"status":  {Value: "released"},
+		}
+	)
+
+	record := func(request *http.Request) (*http.Response, error) {
+		calls = append(calls, request.Method+" "+request.URL.Path)
+
+		return httpmock.NewJsonResponse(200, map[string]interface{}{"name": "x", "value": "x", "immutable": false})
+	}
+
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+		calls = []string{}
+
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, map[string]interface{}{
+				"version": map[string]interface{}{"value": "1.5", "immutable": false},
+				"build":   map[string]interface{}{"value": "10", "immutable": false},
+				"md5Hash": map[string]interface{}{"value": "abc", "immutable": true},
+			})
+		})
+		httpmock.RegisterResponder("PUT", uriMap["meta"]+"/version", record)
+		httpmock.RegisterResponder("POST", uriMap["meta"]+"/status", record)
+		httpmock.RegisterResponder("DELETE", uriMap["meta"]+"/build", record)
+	})
+
+	Context("ComputeMetadataDiff", func() {
+		It("should classify every changed key", func() {
+			diff := shelflib.ComputeMetadataDiff(current, desired)
+			Expect(diff).To(HaveLen(4))
+			Expect(diff[0].Name).To(Equal("build"))
+			Expect(diff[0].Action).To(Equal(shelflib.MetadataRemove))
+			Expect(diff[1].Name).To(Equal("md5Hash"))
+			Expect(diff[1].Action).To(Equal(shelflib.MetadataImmutableConflict))
+			Expect(diff[2].Name).To(Equal("status"))
+			Expect(diff[2].Action).To(Equal(shelflib.MetadataAdd))
+			Expect(diff[3].Name).To(Equal("version"))
+			Expect(diff[3].Action).To(Equal(shelflib.MetadataChange))
+		})
+		It("should leave out unchanged keys", func() {
+			Expect(shelflib.ComputeMetadataDiff(current, current)).To(BeEmpty())
+		})
+		It("should treat nil values as absent", func() {
+			diff := shelflib.ComputeMetadataDiff(
+				map[string]*shelflib.MetadataProperty{"build": shelflib.CreateMetadataProperty("build", "10", false), "status": nil},
+				map[string]*shelflib.MetadataProperty{"build": nil, "status": {Value: "released"}},
+			)
+			Expect(diff).To(HaveLen(2))
+			Expect(diff[0].Action).To(Equal(shelflib.MetadataRemove))
+			Expect(diff[1].Action).To(Equal(shelflib.MetadataAdd))
+		})
+	})
+
+	Context("ApplyMetadata", func() {
+		It("should send only the needed requests", func() {
+			report, err := shelf.ApplyMetadata(uriMap["artifact"], desired, &shelflib.ApplyMetadataOptions{Prune: true})
+			Expect(err.Code).To(Equal(shelflib.CodeForbiddenImmutableProperty))
+			Expect(calls).To(ConsistOf(
+				"DELETE /test/test-artifact/_meta/build",
+				"POST /test/test-artifact/_meta/status",
+				"PUT /test/test-artifact/_meta/version",
+			))
+			Expect(report.Applied).To(HaveLen(3))
+			Expect(report.Failed).To(HaveKey("md5Hash"))
+		})
+		It("should not remove properties without pruning", func() {
+			report, err := shelf.ApplyMetadata(uriMap["artifact"], desired, nil)
+			Expect(err).To(Equal(report.Failed["md5Hash"]))
+			Expect(calls).To(HaveLen(2))
+			Expect(report.Plan).To(HaveLen(3))
+		})
+		It("should print the plan on a dry run", func() {
+			output := &bytes.Buffer{}
+			opts := &shelflib.ApplyMetadataOptions{DryRun: true, Prune: true, Output: output}
+			report, err := shelf.ApplyMetadata(uriMap["artifact"], desired, opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(calls).To(BeEmpty())
+			Expect(report.Applied).To(BeEmpty())
+			Expect(output.String()).To(Equal(`remove build = "10"
+conflict md5Hash is immutable
+add status = "released"
+change version = "1.5" -> "1.6"
+`))
+		})
+	})
+})
@@ -0,0 +1,202 @@
+package shelflib
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Directions reported to Metrics.Transferred.
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Default histogram buckets for request latency, in seconds.
+var LatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Default histogram buckets for transfer size, in bytes.
+var TransferBuckets = []float64{1 << 10, 16 << 10, 256 << 10, 1 << 20, 16 << 20, 256 << 20, 1 << 30}
+
+// Receives measurements of Shelf operations. Operations are ShelfLib
+// method names, as returned by OperationFromContext.
+type Metrics interface {
+	// A request for the operation is about to be sent.
+	RequestStarted(operation string)
+	// A request finished. Code is empty on success, otherwise
+	// it is the Shelf error code or "network_error".
+	RequestDone(operation string, code string, duration time.Duration)
+	// Bytes of an artifact uploaded or downloaded.
+	Transferred(operation string, direction string, bytes int64)
+}
+
+// Publishes metrics with expvar under a single map named name,
+// which must be unique to the process.
+type ExpvarMetrics struct {
+	// Keyed by operation.
+	Requests *expvar.Map
+	// Keyed by "operation:code".
+	Errors *expvar.Map
+	// Keyed by operation.
+	InFlight *expvar.Map
+	// Histograms keyed by operation.
+	Latency *expvar.Map
+	// Histograms keyed by "operation:direction".
+	Transfers *expvar.Map
+}
+
+// Create an ExpvarMetrics and publish it as name.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	metrics := &ExpvarMetrics{
+		Requests:  new(expvar.Map).Init(),
+		Errors:    new(expvar.Map).Init(),
+		InFlight:  new(expvar.Map).Init(),
+		Latency:   new(expvar.Map).Init(),
+		Transfers: new(expvar.Map).Init(),
+	}
+	published := expvar.NewMap(name)
+	published.Set("requests", metrics.Requests)
+	published.Set("errors", metrics.Errors)
+	published.Set("in_flight", metrics.InFlight)
+	published.Set("latency_seconds", metrics.Latency)
+	published.Set("transfer_bytes", metrics.Transfers)
+
+	return metrics
+}
+
+func (this *ExpvarMetrics) RequestStarted(operation string) {
+	this.InFlight.Add(operation, 1)
+}
+
+func (this *ExpvarMetrics) RequestDone(operation string, code string, duration time.Duration) {
+	this.InFlight.Add(operation, -1)
+	this.Requests.Add(operation, 1)
+
+	if code != "" {
+		this.Errors.Add(operation+":"+code, 1)
+	}
+
+	histogram(this.Latency, operation, LatencyBuckets).Observe(duration.Seconds())
+}
+
+func (this *ExpvarMetrics) Transferred(operation string, direction string, bytes int64) {
+	histogram(this.Transfers, operation+":"+direction, TransferBuckets).Observe(float64(bytes))
+}
+
+// Histogram published with expvar as JSON.
+type ExpvarHistogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Create an ExpvarHistogram with the given upper bounds.
+func NewExpvarHistogram(buckets []float64) *ExpvarHistogram {
+	return &ExpvarHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (this *ExpvarHistogram) Observe(value float64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.count++
+	this.sum += value
+
+	for i, bound := range this.buckets {
+		if value <= bound {
+			this.counts[i]++
+		}
+	}
+}
+
+// Formats the histogram as JSON with cumulative bucket counts.
+func (this *ExpvarHistogram) String() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	buckets := make(map[string]uint64)
+
+	for i, bound := range this.buckets {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = this.counts[i]
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"count": this.count, "sum": this.sum, "buckets": buckets})
+
+	return string(data)
+}
+
+var histogramLock sync.Mutex
+
+// Finds or creates the histogram for key in a map.
+func histogram(histograms *expvar.Map, key string, buckets []float64) *ExpvarHistogram {
+	histogramLock.Lock()
+	defer histogramLock.Unlock()
+
+	if existing, ok := histograms.Get(key).(*ExpvarHistogram); ok {
+		return existing
+	}
+
+	created := NewExpvarHistogram(buckets)
+	histograms.Set(key, created)
+
+	return created
+}
+
+// Code reported to Metrics for the outcome of a request.
+func responseCode(response *http.Response, err error) string {
+	if err != nil {
+		if shelfErr, ok := AsShelfError(err); ok && shelfErr.Code != "" {
+			return shelfErr.Code
+		}
+
+		return CodeNetworkError
+	}
+
+	if response.StatusCode >= 400 {
+		return peekErrorCode(response)
+	}
+
+	return ""
+}
+
+// Reports the number of bytes read, and the first error reading
+// them, once the body is read to the end or closed, whichever is first.
+type countingReadCloser struct {
+	io.ReadCloser
+	count    int64
+	err      error
+	done     func(count int64, err error)
+	reported bool
+}
+
+func (this *countingReadCloser) Read(data []byte) (int, error) {
+	n, err := this.ReadCloser.Read(data)
+	this.count += int64(n)
+
+	if err == io.EOF {
+		this.report()
+	} else if err != nil && this.err == nil {
+		this.err = err
+	}
+
+	return n, err
+}
+
+func (this *countingReadCloser) Close() error {
+	this.report()
+
+	return this.ReadCloser.Close()
+}
+
+func (this *countingReadCloser) report() {
+	if !this.reported {
+		this.reported = true
+		this.done(this.count, this.err)
+	}
+}
@@ -0,0 +1,60 @@
+package shelflib_test
+
+import (
+	"encoding/json"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"strings"
+)
+
+var _ = Describe("ExpvarMetrics", func() {
+	var metrics = shelflib.NewExpvarMetrics("shelflib_test")
+
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+		shelf.Request.Metrics = metrics
+
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(404, map[string]string{"message": "Not found", "code": "resource_not_found"})
+		})
+		httpmock.RegisterResponder("GET", uriMap["meta"]+"/version", func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, map[string]interface{}{"name": "version", "value": "1.5", "immutable": false})
+		})
+	})
+
+	It("should publish requests, errors and latency by operation", func() {
+		shelf.GetMetadata(uriMap["artifact"])
+		shelf.GetMetadataProperty(uriMap["artifact"], "version")
+
+		Expect(metrics.Requests.Get("GetMetadata").String()).To(Equal("1"))
+		Expect(metrics.Requests.Get("GetMetadataProperty").String()).To(Equal("1"))
+		Expect(metrics.Errors.Get("GetMetadata:resource_not_found").String()).To(Equal("1"))
+		Expect(metrics.Errors.Get("GetMetadataProperty:resource_not_found")).To(BeNil())
+		Expect(metrics.InFlight.Get("GetMetadata").String()).To(Equal("0"))
+
+		var latency map[string]interface{}
+		Expect(json.Unmarshal([]byte(metrics.Latency.Get("GetMetadata").String()), &latency)).To(Succeed())
+		Expect(latency["count"]).To(Equal(1.0))
+	})
+
+	It("should only count uploads Shelf accepted as transferred", func() {
+		status := 503
+		httpmock.RegisterResponder("POST", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(status, ""), nil
+		})
+
+		shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(metrics.Transfers.Get("UploadArtifact:upload")).To(BeNil())
+
+		status = 201
+		Expect(shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))).To(BeNil())
+
+		var transfers map[string]interface{}
+		Expect(json.Unmarshal([]byte(metrics.Transfers.Get("UploadArtifact:upload").String()), &transfers)).To(Succeed())
+		Expect(transfers["count"]).To(Equal(1.0))
+		Expect(transfers["sum"]).To(Equal(16.0))
+	})
+})
@@ -0,0 +1,176 @@
+package shelflib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Sends a request. Implemented by *http.Client.
+type Doer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// Allows a function to be used as a Doer.
+type DoerFunc func(request *http.Request) (*http.Response, error)
+
+func (this DoerFunc) Do(request *http.Request) (*http.Response, error) {
+	return this(request)
+}
+
+// Wraps the Doer that sends requests to Shelf. It sees the request
+// before the Authorization header is added.
+type Middleware func(next Doer) Doer
+
+type attemptKey struct{}
+
+type idempotentKey struct{}
+
+// Methods Retry retries. POST is left out because an upload that
+// reached Shelf before failing would be retried as a duplicate.
+var idempotentMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true, "PUT": true, "DELETE": true}
+
+// Register middleware. Middleware registered first is outermost.
+func (this *ShelfLib) Use(middleware ...Middleware) {
+	this.Request.Middleware = append(this.Request.Middleware, middleware...)
+}
+
+// Sets the User-Agent header.
+func UserAgent(userAgent string) Middleware {
+	return Headers(http.Header{"User-Agent": []string{userAgent}})
+}
+
+// Sets headers on every request, replacing existing values.
+func Headers(header http.Header) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(request *http.Request) (*http.Response, error) {
+			for key, values := range header {
+				request.Header[http.CanonicalHeaderKey(key)] = values
+			}
+
+			return next.Do(request)
+		})
+	}
+}
+
+// Sets the X-Request-ID header unless the request already has one.
+// A random ID is used if generate is nil.
+func RequestID(generate func() string) Middleware {
+	if generate == nil {
+		generate = randomRequestID
+	}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(request *http.Request) (*http.Response, error) {
+			if request.Header.Get("X-Request-ID") == "" {
+				request.Header.Set("X-Request-ID", generate())
+			}
+
+			return next.Do(request)
+		})
+	}
+}
+
+// Retries requests that fail with a network error or a retryable
+// status, waiting between attempts as backoff says. Only idempotent
+// requests are retried: those with an idempotent method, searches and,
+// as with net/http, requests with an Idempotency-Key header. Requests
+// with a body that cannot be replayed are not retried.
+func Retry(backoff *Backoff) Middleware {
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(request *http.Request) (*http.Response, error) {
+			for attempt := 0; ; attempt++ {
+				attemptRequest := request.WithContext(context.WithValue(request.Context(), attemptKey{}, attempt))
+
+				if attempt > 0 {
+					attemptRequest = request.Clone(attemptRequest.Context())
+
+					if request.GetBody != nil {
+						body, err := request.GetBody()
+
+						if err != nil {
+							return nil, err
+						}
+
+						attemptRequest.Body = body
+					}
+				}
+
+				response, err := next.Do(attemptRequest)
+
+				if attempt+1 >= backoff.Attempts || !shouldRetry(request, response, err) {
+					return response, err
+				}
+
+				if response != nil {
+					response.Body.Close()
+				}
+
+				select {
+				case <-request.Context().Done():
+					return nil, request.Context().Err()
+				case <-time.After(backoff.Delay(attempt)):
+				}
+			}
+		})
+	}
+}
+
+// Attempt number, starting at 0, of a request sent through Retry.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+
+	return attempt
+}
+
+// Marks the requests made with ctx as safe to retry whatever their method.
+func withIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(request *http.Request) bool {
+	if idempotentMethods[request.Method] || request.Context().Value(idempotentKey{}) != nil {
+		return true
+	}
+
+	_, ok := request.Header["Idempotency-Key"]
+
+	if !ok {
+		_, ok = request.Header["X-Idempotency-Key"]
+	}
+
+	return ok
+}
+
+func shouldRetry(request *http.Request, response *http.Response, err error) bool {
+	if !isIdempotent(request) {
+		return false
+	}
+
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		var netErr net.Error
+
+		return errors.As(err, &netErr) && request.Context().Err() == nil
+	}
+
+	return retryableCodes[CodeForStatus(response.StatusCode)]
+}
+
+func randomRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,170 @@
+package shelflib_test
+
+import (
+	"errors"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var _ = Describe("Middleware", func() {
+	var (
+		received  []*http.Request
+		responses []int
+	)
+
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+		received = []*http.Request{}
+		responses = []int{200}
+
+		httpmock.RegisterResponder("GET", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+			status := responses[0]
+			received = append(received, request)
+
+			if len(responses) > 1 {
+				responses = responses[1:]
+			}
+
+			return httpmock.NewStringResponse(status, "Simple Text File"), nil
+		})
+	})
+
+	It("should run middleware in the order it was registered", func() {
+		order := []string{}
+		trace := func(name string) shelflib.Middleware {
+			return func(next shelflib.Doer) shelflib.Doer {
+				return shelflib.DoerFunc(func(request *http.Request) (*http.Response, error) {
+					order = append(order, name)
+
+					return next.Do(request)
+				})
+			}
+		}
+		shelf.Use(trace("first"), trace("second"))
+		shelf.Use(trace("third"))
+		_, err := shelf.DownloadArtifact(uriMap["artifact"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(order).To(Equal([]string{"first", "second", "third"}))
+	})
+
+	It("should set headers", func() {
+		shelf.Use(
+			shelflib.UserAgent("release-bot/1.2"),
+			shelflib.RequestID(func() string { return "abc" }),
+			shelflib.Headers(http.Header{"X-Team": []string{"builds"}}),
+		)
+		_, err := shelf.DownloadArtifact(uriMap["artifact"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(received[0].Header.Get("User-Agent")).To(Equal("release-bot/1.2"))
+		Expect(received[0].Header.Get("X-Request-ID")).To(Equal("abc"))
+		Expect(received[0].Header.Get("X-Team")).To(Equal("builds"))
+		Expect(received[0].Header.Get("Authorization")).To(Equal(validToken))
+	})
+
+	It("should generate request IDs", func() {
+		shelf.Use(shelflib.RequestID(nil))
+		shelf.DownloadArtifact(uriMap["artifact"])
+		Expect(received[0].Header.Get("X-Request-ID")).To(HaveLen(32))
+	})
+
+	It("should allow faults to be injected", func() {
+		shelf.Use(func(next shelflib.Doer) shelflib.Doer {
+			return shelflib.DoerFunc(func(request *http.Request) (*http.Response, error) {
+				return nil, shelflib.CreateShelfError("Injected.", shelflib.CodeServiceUnavailable)
+			})
+		})
+		_, err := shelf.DownloadArtifact(uriMap["artifact"])
+		Expect(err.Code).To(Equal(shelflib.CodeServiceUnavailable))
+		Expect(received).To(BeEmpty())
+	})
+
+	Context("Retry", func() {
+		It("should retry retryable statuses", func() {
+			responses = []int{503, 502, 200}
+			attempts := []int{}
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 3}), func(next shelflib.Doer) shelflib.Doer {
+				return shelflib.DoerFunc(func(request *http.Request) (*http.Response, error) {
+					attempts = append(attempts, shelflib.AttemptFromContext(request.Context()))
+
+					return next.Do(request)
+				})
+			})
+			_, err := shelf.DownloadArtifact(uriMap["artifact"])
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(received).To(HaveLen(3))
+			Expect(attempts).To(Equal([]int{0, 1, 2}))
+		})
+
+		It("should give up after the configured attempts", func() {
+			responses = []int{503}
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 2}))
+			_, err := shelf.DownloadArtifact(uriMap["artifact"])
+			Expect(shelflib.IsRetryable(err)).To(BeTrue())
+			Expect(received).To(HaveLen(2))
+		})
+
+		It("should not retry other failures", func() {
+			responses = []int{404}
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 3}))
+			_, err := shelf.DownloadArtifact(uriMap["artifact"])
+			Expect(shelflib.IsNotFound(err)).To(BeTrue())
+			Expect(received).To(HaveLen(1))
+		})
+
+		It("should replay request bodies", func() {
+			bodies := []string{}
+			httpmock.RegisterResponder("PUT", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+				body, err := ioutil.ReadAll(request.Body)
+				Expect(err).ShouldNot(HaveOccurred())
+				bodies = append(bodies, string(body))
+
+				if len(bodies) == 1 {
+					return nil, errors.New("connection reset")
+				}
+
+				return httpmock.NewJsonResponse(200, testMetadata)
+			})
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 3}))
+			_, err := shelf.UpdateMetadata(uriMap["artifact"], map[string]*shelflib.MetadataProperty{"build": shelflib.CreateMetadataProperty("build", "10", false)})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(bodies).To(HaveLen(2))
+			Expect(bodies[1]).To(Equal(bodies[0]))
+			Expect(bodies[1]).To(ContainSubstring(`"build"`))
+		})
+
+		It("should not retry uploads", func() {
+			uploads := 0
+			httpmock.RegisterResponder("POST", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+				uploads++
+
+				return httpmock.NewStringResponse(503, ""), nil
+			})
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 3}))
+			err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+			Expect(shelflib.IsRetryable(err)).To(BeTrue())
+			Expect(uploads).To(Equal(1))
+		})
+
+		It("should retry searches", func() {
+			searches := 0
+			httpmock.RegisterResponder("POST", uriMap["search"], func(request *http.Request) (*http.Response, error) {
+				searches++
+
+				if searches == 1 {
+					return httpmock.NewStringResponse(503, ""), nil
+				}
+
+				return httpmock.NewStringResponse(204, ""), nil
+			})
+			shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 3}))
+			_, err := shelf.Search(uriMap["artifact"], nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(searches).To(Equal(2))
+		})
+	})
+})
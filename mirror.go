@@ -0,0 +1,394 @@
+package shelflib
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type DriftKind string
+
+const (
+	// The artifact is only at the source. Mirror copies it.
+	DriftMissing DriftKind = "missing"
+	// The artifact is only at the destination. Mirror leaves it alone.
+	DriftExtra DriftKind = "extra"
+	// The artifacts have different sha256. Shelf cannot overwrite
+	// artifacts, so it is reported as a failure.
+	DriftContent DriftKind = "content"
+	// A metadata property differs. Mirror reconciles it unless the
+	// destination has it immutable.
+	DriftMetadata DriftKind = "metadata"
+)
+
+// A difference Mirror found between the source and the destination.
+type MirrorDrift struct {
+	// Path relative to both prefixes.
+	Path string
+	Kind DriftKind
+	// The property that differs, for DriftMetadata.
+	Metadata *MetadataDiffEntry
+	// Whether Mirror brought the destination in line.
+	Reconciled bool
+}
+
+// Options for Mirror.
+type MirrorOptions struct {
+	// Writes the destination, for mirrors to another Shelf host or
+	// with another token. Defaults to the ShelfLib that reads the source.
+	Destination *ShelfLib
+	// Artifacts compared and copied at once. Defaults to DefaultConcurrency.
+	Concurrency int
+	// Only artifacts matching one of these globs are mirrored, if any are given.
+	Include []string
+	// Artifacts and directories matching one of these globs are left out.
+	Exclude []string
+	// Metadata properties that are neither copied nor reconciled.
+	SkipMetadata []string
+	// Remove mutable properties the source does not have.
+	Prune bool
+	// File that every mirrored artifact is recorded in. Artifacts already
+	// in it are skipped, so that an interrupted run resumes where it
+	// stopped. It is removed once a run has no failures.
+	Checkpoint string
+}
+
+// Result of Mirror. In the embedded TransferReport, Transferred has the
+// artifacts that were copied and Bytes is not counted.
+type MirrorReport struct {
+	// Every difference that was found, sorted by path.
+	Drift []*MirrorDrift
+	// Sorted paths of artifacts whose metadata was reconciled.
+	Reconciled []string
+	*TransferReport
+	lock sync.Mutex
+}
+
+// Formats the drift as a line of a summary.
+func (this *MirrorDrift) String() string {
+	line := string(this.Kind) + " " + this.Path
+
+	if this.Metadata != nil {
+		line += ": " + this.Metadata.String()
+	}
+
+	if !this.Reconciled {
+		line += " (not reconciled)"
+	}
+
+	return line
+}
+
+func (this *MirrorReport) drifted(drift ...*MirrorDrift) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Drift = append(this.Drift, drift...)
+}
+
+func (this *MirrorReport) reconciled(relativePath string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Reconciled = append(this.Reconciled, relativePath)
+}
+
+// Replicates the artifacts under srcPrefix to dstPrefix, the URLs of
+// directories, usually on two Shelf hosts. It is incremental: missing
+// artifacts are copied with CopyArtifact and the metadata of those
+// already there is reconciled with ApplyMetadata. Every difference
+// found is in the report's Drift. Failures of single artifacts are in
+// the report. An error is only returned when the mirror cannot run.
+func (this *ShelfLib) Mirror(srcPrefix string, dstPrefix string, opts *MirrorOptions) (*MirrorReport, *ShelfError) {
+	if opts == nil {
+		opts = &MirrorOptions{}
+	}
+
+	shelfLib, end := this.operation("Mirror")
+	defer end()
+
+	destination := shelfLib
+
+	if opts.Destination != nil {
+		destination = opts.Destination.WithContext(shelfLib.Context())
+	}
+
+	report := &MirrorReport{Drift: make([]*MirrorDrift, 0), Reconciled: make([]string, 0), TransferReport: newTransferReport()}
+	checkpoint, shelfErr := openCheckpoint(opts.Checkpoint, srcPrefix, dstPrefix)
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	defer checkpoint.close()
+
+	artifacts := make(map[string]string)
+	filter := newPathFilter(opts.Include, opts.Exclude)
+
+	shelfErr = shelfLib.Walk(srcPrefix, func(relativePath string, record *ArtifactRecord) error {
+		if filter.excluded(relativePath) {
+			report.skipped(relativePath, "excluded")
+
+			if isDirectoryRecord(record) {
+				return ErrSkipDirectory
+			}
+		} else if isDirectoryRecord(record) {
+			return nil
+		} else if !filter.included(relativePath) {
+			report.skipped(relativePath, "not included")
+		} else if checkpoint.done[relativePath] {
+			report.skipped(relativePath, "checkpoint")
+		} else {
+			artifacts[relativePath] = record.Url
+		}
+
+		return nil
+	})
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	mirrored, shelfErr := destination.listRemote(dstPrefix)
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	for _, relativePath := range sortedKeys(mirrored) {
+		if _, ok := report.Skipped[relativePath]; ok || filter.excluded(relativePath) || !filter.included(relativePath) {
+			continue
+		}
+
+		if _, ok := artifacts[relativePath]; !ok {
+			report.drifted(&MirrorDrift{Path: relativePath, Kind: DriftExtra})
+		}
+	}
+
+	forEachConcurrently(sortedKeys(artifacts), opts.Concurrency, func(relativePath string) {
+		shelfErr := shelfLib.mirrorArtifact(relativePath, artifacts[relativePath], JoinArtifactPath(dstPrefix, relativePath), mirrored[relativePath] != "", destination, opts, report)
+
+		if shelfErr == nil {
+			shelfErr = checkpoint.record(relativePath)
+		}
+
+		if shelfErr != nil {
+			report.failed(relativePath, shelfErr)
+		}
+	})
+
+	sort.SliceStable(report.Drift, func(i int, j int) bool {
+		return report.Drift[i].Path < report.Drift[j].Path
+	})
+	sort.Strings(report.Reconciled)
+	report.sort()
+
+	if len(report.Failed) == 0 {
+		if shelfErr := checkpoint.remove(); shelfErr != nil {
+			return report, shelfErr
+		}
+	}
+
+	return report, nil
+}
+
+// Copies or reconciles one artifact of Mirror.
+func (this *ShelfLib) mirrorArtifact(relativePath string, srcUrl string, dstUrl string, exists bool, destination *ShelfLib, opts *MirrorOptions, report *MirrorReport) *ShelfError {
+	if err := this.Context().Err(); err != nil {
+		return CreateShelfErrorFromError(err)
+	}
+
+	if !exists {
+		drift := &MirrorDrift{Path: relativePath, Kind: DriftMissing}
+		report.drifted(drift)
+
+		if shelfErr := this.CopyArtifact(srcUrl, dstUrl, &CopyOptions{Destination: destination, SkipMetadata: opts.SkipMetadata}); shelfErr != nil {
+			return shelfErr
+		}
+
+		drift.Reconciled = true
+		report.transferred(relativePath, 0)
+
+		return nil
+	}
+
+	source, shelfErr := this.GetMetadata(srcUrl)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	current, shelfErr := destination.GetMetadata(dstUrl)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	sourceHash, destinationHash := "", ""
+
+	if prop, ok := source[PropertySha256Hash]; ok {
+		sourceHash = prop.Value
+	}
+
+	if prop, ok := current[PropertySha256Hash]; ok {
+		destinationHash = prop.Value
+	}
+
+	if sourceHash != destinationHash {
+		report.drifted(&MirrorDrift{Path: relativePath, Kind: DriftContent})
+
+		return CreateShelfError("Artifact "+dstUrl+" has sha256 "+destinationHash+", the source has "+sourceHash+".", CodeContentMismatch)
+	}
+
+	// What the destination set itself or is told to keep is
+	// desired as it is, so that it never shows up as drift.
+	desired := make(map[string]*MetadataProperty)
+
+	for _, name := range append(uploadProperties, opts.SkipMetadata...) {
+		if prop, ok := current[name]; ok {
+			desired[name] = prop
+		}
+	}
+
+	for name, prop := range source {
+		if _, ok := desired[name]; !ok && !contains(uploadProperties, name) && !contains(opts.SkipMetadata, name) {
+			desired[name] = prop
+		}
+	}
+
+	applied, shelfErr := destination.ApplyMetadata(dstUrl, desired, &ApplyMetadataOptions{Prune: opts.Prune})
+
+	if len(applied.Plan) == 0 {
+		if shelfErr == nil {
+			report.skipped(relativePath, "unchanged")
+		}
+
+		return shelfErr
+	}
+
+	drift := make([]*MirrorDrift, 0, len(applied.Plan))
+
+	for _, entry := range applied.Plan {
+		_, failed := applied.Failed[entry.Name]
+		drift = append(drift, &MirrorDrift{Path: relativePath, Kind: DriftMetadata, Metadata: entry, Reconciled: !failed})
+	}
+
+	report.drifted(drift...)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	report.reconciled(relativePath)
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The checkpoint file of Mirror. Its first line names the prefixes
+// it is for, every other line is the path of a mirrored artifact.
+type mirrorCheckpoint struct {
+	path string
+	file *os.File
+	done map[string]bool
+	lock sync.Mutex
+}
+
+func openCheckpoint(checkpointPath string, srcPrefix string, dstPrefix string) (*mirrorCheckpoint, *ShelfError) {
+	checkpoint := &mirrorCheckpoint{path: checkpointPath, done: make(map[string]bool)}
+
+	if checkpointPath == "" {
+		return checkpoint, nil
+	}
+
+	header := "# mirror " + srcPrefix + " " + dstPrefix
+	file, err := os.OpenFile(checkpointPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	empty := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if empty {
+			empty = false
+
+			if line != header {
+				file.Close()
+
+				return nil, CreateShelfError("Checkpoint "+checkpointPath+" is not for a mirror of "+srcPrefix+" to "+dstPrefix+".", CodeBadRequest)
+			}
+
+			continue
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			checkpoint.done[line] = true
+		}
+	}
+
+	if err = scanner.Err(); err == nil && empty {
+		_, err = file.WriteString(header + "\n")
+	}
+
+	if err != nil {
+		file.Close()
+
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	checkpoint.file = file
+
+	return checkpoint, nil
+}
+
+func (this *mirrorCheckpoint) record(relativePath string) *ShelfError {
+	if this.file == nil {
+		return nil
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, err := this.file.WriteString(relativePath + "\n"); err != nil {
+		return CreateShelfErrorFromError(err)
+	}
+
+	return nil
+}
+
+func (this *mirrorCheckpoint) close() {
+	if this.file != nil {
+		this.file.Close()
+	}
+}
+
+func (this *mirrorCheckpoint) remove() *ShelfError {
+	if this.file == nil {
+		return nil
+	}
+
+	this.close()
+	this.file = nil
+
+	if err := os.Remove(this.path); err != nil && !os.IsNotExist(err) {
+		return CreateShelfErrorFromError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package shelflib_test
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Mirror", func() {
+	var (
+		primary   *shelftest.Server
+		secondary *shelftest.Server
+		client    *shelflib.ShelfLib
+		opts      *shelflib.MirrorOptions
+		src       string
+		dst       string
+		dir       string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "mirror")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		primary = shelftest.NewServer(validToken)
+		primary.PutArtifact("dev", "builds/app.tar.gz", []byte("app"))
+		primary.PutArtifact("dev", "builds/docs/readme.md", []byte("readme"))
+		primary.PutArtifact("dev", "builds/build.log", []byte("log"))
+		primary.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("version", "1.2", true))
+		primary.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("status", "tested", false))
+		secondary = shelftest.NewServer("OTHERTOKEN")
+
+		client = primary.NewShelf(validToken)
+		opts = &shelflib.MirrorOptions{
+			Destination: secondary.NewShelf("OTHERTOKEN"),
+			Exclude:     []string{"*.log"},
+			Checkpoint:  filepath.Join(dir, "checkpoint"),
+		}
+		src = primary.ArtifactUrl("dev", "builds")
+		dst = secondary.ArtifactUrl("dr", "builds")
+	})
+
+	AfterEach(func() {
+		primary.Close()
+		secondary.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should copy missing artifacts with their metadata", func() {
+		report, shelfErr := client.Mirror(src, dst, opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Err()).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"app.tar.gz", "docs/readme.md"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"build.log": "excluded"}))
+		Expect(report.Drift).To(HaveLen(2))
+		Expect(report.Drift[0].String()).To(Equal("missing app.tar.gz"))
+
+		content, metadata, ok := secondary.Artifact("dr", "builds/app.tar.gz")
+		Expect(ok).To(BeTrue())
+		Expect(string(content)).To(Equal("app"))
+		Expect(metadata["version"]).To(Equal(shelflib.CreateMetadataProperty("version", "1.2", true)))
+		Expect(metadata["status"].Value).To(Equal("tested"))
+
+		_, err := os.Stat(opts.Checkpoint)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		report, shelfErr = client.Mirror(src, dst, opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Transferred).To(BeEmpty())
+		Expect(report.Drift).To(BeEmpty())
+		Expect(report.Skipped["app.tar.gz"]).To(Equal("unchanged"))
+	})
+
+	It("should reconcile metadata and summarize drift", func() {
+		_, shelfErr := client.Mirror(src, dst, opts)
+		Expect(shelfErr).To(BeNil())
+
+		primary.SetMetadata("dev", "builds/app.tar.gz", shelflib.CreateMetadataProperty("status", "released", false))
+		primary.SetMetadata("dev", "builds/docs/readme.md", shelflib.CreateMetadataProperty("version", "2", true))
+		secondary.SetMetadata("dr", "builds/docs/readme.md", shelflib.CreateMetadataProperty("version", "1", true))
+		secondary.PutArtifact("dr", "builds/old.tar.gz", []byte("old"))
+		primary.PutArtifact("dev", "builds/new.tar.gz", []byte("new"))
+		secondary.PutArtifact("dr", "builds/new.tar.gz", []byte("other"))
+
+		report, shelfErr := client.Mirror(src, dst, opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Reconciled).To(Equal([]string{"app.tar.gz"}))
+		Expect(report.Failed).To(HaveLen(2))
+		Expect(report.Failed["new.tar.gz"].Code).To(Equal(shelflib.CodeContentMismatch))
+		Expect(report.Failed["docs/readme.md"].Code).To(Equal(shelflib.CodeForbiddenImmutableProperty))
+
+		summary := make([]string, 0)
+
+		for _, drift := range report.Drift {
+			summary = append(summary, drift.String())
+		}
+
+		Expect(summary).To(Equal([]string{
+			`metadata app.tar.gz: change status = "tested" -> "released"`,
+			`metadata docs/readme.md: conflict version is immutable (not reconciled)`,
+			`content new.tar.gz (not reconciled)`,
+			`extra old.tar.gz (not reconciled)`,
+		}))
+
+		_, metadata, _ := secondary.Artifact("dr", "builds/app.tar.gz")
+		Expect(metadata["status"].Value).To(Equal("released"))
+
+		checkpoint, err := ioutil.ReadFile(opts.Checkpoint)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(checkpoint)).To(Equal("# mirror " + src + " " + dst + "\napp.tar.gz\n"))
+	})
+
+	It("should resume from a checkpoint", func() {
+		Expect(ioutil.WriteFile(opts.Checkpoint, []byte("# mirror "+src+" "+dst+"\napp.tar.gz\n"), 0644)).To(Succeed())
+
+		report, shelfErr := client.Mirror(src, dst, opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"docs/readme.md"}))
+		Expect(report.Skipped["app.tar.gz"]).To(Equal("checkpoint"))
+
+		_, _, ok := secondary.Artifact("dr", "builds/app.tar.gz")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should refuse a checkpoint of another mirror", func() {
+		Expect(ioutil.WriteFile(opts.Checkpoint, []byte("# mirror "+src+" elsewhere\n"), 0644)).To(Succeed())
+
+		_, shelfErr := client.Mirror(src, dst, opts)
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeBadRequest))
+		Expect(secondary.Requests()).To(BeEmpty())
+	})
+})
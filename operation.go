@@ -0,0 +1,64 @@
+package shelflib
+
+import (
+	"context"
+)
+
+type operationKey struct{}
+
+type operationSpanKey struct{}
+
+// Name used for requests not made by a ShelfLib operation.
+const UnknownOperation = "request"
+
+// Copy of the ShelfLib whose requests are made with ctx,
+// so that they can be cancelled or carry values.
+func (this *ShelfLib) WithContext(ctx context.Context) *ShelfLib {
+	shelfLib := *this
+	request := *this.Request
+	request.ctx = ctx
+	shelfLib.Request = &request
+
+	return &shelfLib
+}
+
+// Context requests are made with. Defaults to context.Background.
+func (this *ShelfLib) Context() context.Context {
+	return this.Request.context()
+}
+
+// Name of the ShelfLib operation, such as "GetMetadata",
+// a request is being made for.
+func OperationFromContext(ctx context.Context) string {
+	if operation, ok := ctx.Value(operationKey{}).(string); ok {
+		return operation
+	}
+
+	return UnknownOperation
+}
+
+// Starts the named operation. Returns a copy of the ShelfLib whose
+// requests are made for it and a function that ends the operation.
+func (this *ShelfLib) operation(name string) (*ShelfLib, func()) {
+	ctx := context.WithValue(this.Context(), operationKey{}, name)
+	ctx, span := this.Request.tracer().Start(ctx, "shelf."+name)
+	ctx = context.WithValue(ctx, operationSpanKey{}, span)
+
+	return this.WithContext(ctx), span.End
+}
+
+// Request of a newly started operation. See operation.
+func (this *ShelfLib) requestFor(name string) (*Request, func()) {
+	shelfLib, end := this.operation(name)
+
+	return shelfLib.Request, end
+}
+
+// Span of the operation a request is being made for, if any.
+func operationSpan(ctx context.Context) Span {
+	if span, ok := ctx.Value(operationSpanKey{}).(Span); ok {
+		return span
+	}
+
+	return noopSpan{}
+}
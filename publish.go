@@ -0,0 +1,153 @@
+package shelflib
+
+import (
+	"io"
+)
+
+// Property and value Publish marks an artifact with when its
+// metadata could not be applied. Search with "publish_state!=incomplete"
+// to leave such artifacts out.
+const (
+	PublishStateProperty = "publish_state"
+	PublishIncomplete    = "incomplete"
+)
+
+// Options for Publish.
+type PublishOptions struct {
+	// Property the artifact is marked with when its metadata cannot
+	// be applied. Defaults to PublishStateProperty.
+	StateProperty string
+	// Value it is set to. Defaults to PublishIncomplete.
+	IncompleteValue string
+	// Upload with UploadArtifactOnce, so that publishing the same
+	// content again only applies the metadata.
+	SkipIdentical bool
+}
+
+// Upload an artifact and apply its metadata, retrying the metadata with
+// the ShelfLib's Backoff and reading it back to confirm it. Immutable
+// properties are set as given and nil values are left out. If the
+// metadata cannot be applied the artifact is marked with
+// opts.StateProperty so that searches can leave it out, and the error
+// that stopped the metadata is returned. Publishing it again with
+// SkipIdentical repairs it and removes the mark.
+func (this *ShelfLib) Publish(path string, reader io.Reader, metadata map[string]*MetadataProperty, opts *PublishOptions) *ShelfError {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+
+	shelfLib, end := this.operation("Publish")
+	defer end()
+
+	var shelfErr *ShelfError
+
+	if opts.SkipIdentical {
+		_, shelfErr = shelfLib.UploadArtifactOnce(path, reader, nil)
+	} else {
+		shelfErr = shelfLib.UploadArtifact(path, reader)
+	}
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	stateProperty := opts.StateProperty
+
+	if stateProperty == "" {
+		stateProperty = PublishStateProperty
+	}
+
+	incomplete := opts.IncompleteValue
+
+	if incomplete == "" {
+		incomplete = PublishIncomplete
+	}
+
+	desired := make(map[string]*MetadataProperty)
+
+	for name, prop := range metadata {
+		if prop != nil {
+			desired[name] = CreateMetadataProperty(name, prop.Value, prop.Immutable)
+		}
+	}
+
+	if len(desired) == 0 {
+		return nil
+	}
+
+	current, shelfErr := shelfLib.applyPublishedMetadata(path, desired)
+
+	if shelfErr == nil {
+		// A rerun that repaired an incomplete artifact clears the mark.
+		if _, ok := current[stateProperty]; ok {
+			if _, ok = desired[stateProperty]; !ok {
+				shelfErr = shelfLib.DeleteMetadataProperty(path, stateProperty)
+			}
+		}
+
+		return shelfErr
+	}
+
+	return shelfLib.markIncomplete(path, stateProperty, incomplete, shelfErr)
+}
+
+// Marks the artifact at path with property=value so that searches can
+// leave it out, and returns shelfErr, the reason it is incomplete.
+func (this *ShelfLib) markIncomplete(path string, property string, value string, shelfErr *ShelfError) *ShelfError {
+	// Left mutable so that the artifact can be repaired later.
+	if _, markErr := this.UpdateMetadataProperty(path, CreateMetadataProperty(property, value, false)); markErr != nil {
+		unmarked := CreateShelfError(shelfErr.Message+" Marking it "+property+"="+value+" failed too: "+markErr.Message, shelfErr.Code)
+		unmarked.Parent = shelfErr
+
+		return unmarked
+	}
+
+	return shelfErr
+}
+
+// Sets the metadata and reads it back until it matches, for as
+// many attempts as the Backoff allows, and returns what was read.
+// Errors that cannot go away by retrying end it early.
+func (this *ShelfLib) applyPublishedMetadata(path string, desired map[string]*MetadataProperty) (map[string]*MetadataProperty, *ShelfError) {
+	backoff := this.Backoff
+
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		current, shelfErr := this.confirmMetadata(path, desired)
+
+		if shelfErr == nil {
+			return current, nil
+		}
+
+		if (!IsRetryable(shelfErr) && shelfErr.Code != CodeMissingMetadataProperty) || attempt+1 >= backoff.Attempts {
+			return nil, shelfErr
+		}
+
+		if err := backoff.Wait(this.Context(), attempt); err != nil {
+			return nil, CreateShelfErrorFromError(err)
+		}
+	}
+}
+
+func (this *ShelfLib) confirmMetadata(path string, desired map[string]*MetadataProperty) (map[string]*MetadataProperty, *ShelfError) {
+	if _, shelfErr := this.UpdateMetadata(path, desired); shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	current, shelfErr := this.GetMetadata(path)
+
+	if shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	for name, prop := range desired {
+		if got, ok := current[name]; !ok || got.Value != prop.Value || got.Immutable != prop.Immutable {
+			return nil, CreateShelfError("Metadata property "+name+" was not applied to "+path+".", CodeMissingMetadataProperty)
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,147 @@
+package shelflib_test
+
+import (
+	"context"
+	"errors"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Publish", func() {
+	var (
+		server      *shelftest.Server
+		client      *shelflib.ShelfLib
+		artifactUrl string
+		failures    int
+		metadata    map[string]*shelflib.MetadataProperty
+	)
+
+	BeforeEach(func() {
+		server = shelftest.NewServer(validToken)
+		client = server.NewShelf(validToken)
+		client.Backoff = &shelflib.Backoff{Attempts: 3}
+		artifactUrl = server.ArtifactUrl("test", "builds/app.tar.gz")
+		failures = 0
+		metadata = map[string]*shelflib.MetadataProperty{
+			"version": shelflib.CreateMetadataProperty("version", "1.2", true),
+			"build":   shelflib.CreateMetadataProperty("build", "7", false),
+		}
+
+		// Fails the next failures bulk metadata updates.
+		client.Use(func(next shelflib.Doer) shelflib.Doer {
+			return shelflib.DoerFunc(func(request *http.Request) (*http.Response, error) {
+				if request.Method == "PUT" && strings.HasSuffix(request.URL.Path, "/_meta") && failures > 0 {
+					failures--
+
+					return &http.Response{
+						StatusCode: http.StatusServiceUnavailable,
+						Header:     http.Header{"Content-Type": {"application/json"}},
+						Body:       ioutil.NopCloser(strings.NewReader(`{"message": "Unavailable", "code": "service_unavailable"}`)),
+						Request:    request,
+					}, nil
+				}
+
+				return next.Do(request)
+			})
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload and apply metadata", func() {
+		Expect(client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)).To(BeNil())
+
+		content, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(string(content)).To(Equal("app"))
+		Expect(stored["version"]).To(Equal(shelflib.CreateMetadataProperty("version", "1.2", true)))
+		Expect(stored["build"]).To(Equal(shelflib.CreateMetadataProperty("build", "7", false)))
+		Expect(stored).ShouldNot(HaveKey(shelflib.PublishStateProperty))
+	})
+
+	It("should leave out nil metadata values", func() {
+		metadata["build"] = nil
+
+		Expect(client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)).To(BeNil())
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored["version"].Value).To(Equal("1.2"))
+		Expect(stored).ShouldNot(HaveKey("build"))
+	})
+
+	It("should retry the metadata", func() {
+		failures = 2
+
+		Expect(client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)).To(BeNil())
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored["version"].Value).To(Equal("1.2"))
+	})
+
+	It("should mark the artifact incomplete when the metadata fails", func() {
+		failures = 3
+
+		shelfErr := client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeServiceUnavailable))
+
+		_, stored, ok := server.Artifact("test", "builds/app.tar.gz")
+		Expect(ok).To(BeTrue())
+		Expect(stored).ShouldNot(HaveKey("version"))
+		Expect(stored[shelflib.PublishStateProperty]).To(Equal(shelflib.CreateMetadataProperty(shelflib.PublishStateProperty, shelflib.PublishIncomplete, false)))
+	})
+
+	It("should clear the mark when a rerun repairs the artifact", func() {
+		failures = 3
+
+		Expect(client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)).ShouldNot(BeNil())
+		Expect(client.Publish(artifactUrl, strings.NewReader("app"), metadata, &shelflib.PublishOptions{SkipIdentical: true})).To(BeNil())
+
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored["version"].Value).To(Equal("1.2"))
+		Expect(stored).ShouldNot(HaveKey(shelflib.PublishStateProperty))
+	})
+
+	It("should stop retrying once the context is done", func() {
+		failures = 3
+		client.Backoff = &shelflib.Backoff{Attempts: 3, Initial: time.Hour, Max: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		shelfErr := client.WithContext(ctx).Publish(artifactUrl, strings.NewReader("app"), metadata, nil)
+		Expect(errors.Is(shelfErr, context.Canceled)).To(BeTrue())
+	})
+
+	It("should use the configured state property", func() {
+		failures = 3
+
+		client.Publish(artifactUrl, strings.NewReader("app"), metadata, &shelflib.PublishOptions{StateProperty: "state", IncompleteValue: "broken"})
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored["state"].Value).To(Equal("broken"))
+	})
+
+	It("should not retry metadata Shelf rejects", func() {
+		server.PutArtifact("test", "builds/app.tar.gz", []byte("app"))
+		server.SetMetadata("test", "builds/app.tar.gz", shelflib.CreateMetadataProperty("version", "1.0", true))
+
+		shelfErr := client.Publish(artifactUrl, strings.NewReader("app"), metadata, &shelflib.PublishOptions{SkipIdentical: true})
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeForbiddenImmutableProperty))
+
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored[shelflib.PublishStateProperty].Value).To(Equal(shelflib.PublishIncomplete))
+	})
+
+	It("should fail without marking when the upload fails", func() {
+		server.PutArtifact("test", "builds/app.tar.gz", []byte("other"))
+
+		shelfErr := client.Publish(artifactUrl, strings.NewReader("app"), metadata, nil)
+		Expect(shelfErr.Code).To(Equal(shelflib.CodeDuplicateArtifact))
+
+		_, stored, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(stored).ShouldNot(HaveKey(shelflib.PublishStateProperty))
+	})
+})
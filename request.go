@@ -2,19 +2,35 @@ package shelflib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"time"
 )
 
 type Request struct {
 	Logger     *log.Logger
 	ShelfToken string
+	// Used instead of ShelfToken when set.
+	TokenSource TokenSource
+	// Used to send requests. A default client is used if nil.
+	Client *http.Client
+	// Wraps the sending of every request, outermost first.
+	Middleware []Middleware
+	// Every request sent is logged here when set.
+	Log *slog.Logger
+	// Records every request sent when set.
+	Metrics Metrics
+	// Creates spans for operations and requests when set.
+	Tracer Tracer
+	ctx    context.Context
 }
 
 var SuffixMap = map[string]string{"meta": "_meta", "search": "_search", "artifact": ""}
@@ -58,7 +74,7 @@ func (this *Request) Upload(path string, data io.Reader) (*http.Response, *Shelf
 		return nil, shelfErr
 	}
 
-	_, err = io.Copy(part, data)
+	count, err := io.Copy(part, data)
 
 	if err != nil {
 		shelfErr = CreateShelfErrorFromError(err)
@@ -66,7 +82,16 @@ func (this *Request) Upload(path string, data io.Reader) (*http.Response, *Shelf
 		return nil, shelfErr
 	}
 
-	req, err := http.NewRequest("POST", requestURI, body)
+	// Writes the closing boundary of the form.
+	err = multiWriter.Close()
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return nil, shelfErr
+	}
+
+	req, err := http.NewRequestWithContext(this.context(), "POST", requestURI, body)
 
 	if err != nil {
 		shelfErr = CreateShelfErrorFromError(err)
@@ -76,11 +101,87 @@ func (this *Request) Upload(path string, data io.Reader) (*http.Response, *Shelf
 
     req.Header.Add("Content-Type", multiWriter.FormDataContentType())
 
-	return this.PeformRequest(req)
+	resp, shelfErr := this.PeformRequest(req)
+
+	// Only uploads Shelf accepted count as transferred.
+	if shelfErr == nil && resp.StatusCode < 400 && this.Metrics != nil {
+		this.Metrics.Transferred(OperationFromContext(this.context()), DirectionUpload, count)
+	}
+
+	return resp, shelfErr
+}
+
+// Like Upload, but the form is written while the request is sent
+// instead of being buffered first, so large artifacts are never held
+// in memory. The body cannot be replayed, so a rejected token is not
+// refreshed and retried.
+func (this *Request) UploadStream(path string, data io.Reader) (*http.Response, *ShelfError) {
+	requestURI, err := this.buildUrl(path, "artifact", "")
+
+	if err != nil {
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	_, filePath := filepath.Split(path)
+	body, bodyWriter := io.Pipe()
+	multiWriter := multipart.NewWriter(bodyWriter)
+
+	counted := make(chan int64, 1)
+
+	go func() {
+		var count int64
+
+		part, err := multiWriter.CreateFormFile("file", filePath)
+
+		if err == nil {
+			count, err = io.Copy(part, data)
+		}
+
+		if err == nil {
+			err = multiWriter.Close()
+		}
+
+		bodyWriter.CloseWithError(err)
+		counted <- count
+	}()
+
+	req, err := http.NewRequestWithContext(this.context(), "POST", requestURI, body)
+
+	if err != nil {
+		body.Close()
+
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	req.Header.Add("Content-Type", multiWriter.FormDataContentType())
+	resp, shelfErr := this.PeformRequest(req)
+
+	// So that the writer never blocks if the body was not read to the end.
+	body.Close()
+	count := <-counted
+
+	// Only uploads Shelf accepted count as transferred.
+	if shelfErr == nil && resp.StatusCode < 400 && this.Metrics != nil {
+		this.Metrics.Transferred(OperationFromContext(this.context()), DirectionUpload, count)
+	}
+
+	return resp, shelfErr
 }
 
 // Performs request on Shelf.
 func (this *Request) DoRequest(verb string, path string, requestType string, property string, data io.Reader) (*http.Response, *ShelfError) {
+	req, shelfErr := this.NewRequest(verb, path, requestType, property, data)
+
+	if shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	return this.PeformRequest(req)
+}
+
+// Creates a request on Shelf without performing it so that
+// headers can be added first.
+func (this *Request) NewRequest(verb string, path string, requestType string, property string, data io.Reader) (*http.Request, *ShelfError) {
 	var shelfErr *ShelfError
 
 	requestURI, err := this.buildUrl(path, requestType, property)
@@ -91,7 +192,7 @@ func (this *Request) DoRequest(verb string, path string, requestType string, pro
 		return nil, shelfErr
 	}
 
-	req, err := http.NewRequest(verb, requestURI, data)
+	req, err := http.NewRequestWithContext(this.context(), verb, requestURI, data)
 
 	if err != nil {
 		shelfErr = CreateShelfErrorFromError(err)
@@ -99,18 +200,53 @@ func (this *Request) DoRequest(verb string, path string, requestType string, pro
 		return nil, shelfErr
 	}
 
-	return this.PeformRequest(req)
+	return req, shelfErr
 }
 
+// Performs a request on Shelf through the middleware.
 func (this *Request) PeformRequest(request *http.Request) (*http.Response, *ShelfError) {
-	var shelfErr *ShelfError
+	var (
+		doer     Doer = DoerFunc(this.send)
+		shelfErr *ShelfError
+	)
 
-	request.Header.Add("Authorization", this.ShelfToken)
-	client := &http.Client{}
+	for i := len(this.Middleware) - 1; i >= 0; i-- {
+		doer = this.Middleware[i](doer)
+	}
 
-	resp, err := client.Do(request)
+	operation := OperationFromContext(request.Context())
+	start := time.Now()
+
+	if this.Metrics != nil {
+		this.Metrics.RequestStarted(operation)
+	}
+
+	resp, err := doer.Do(request)
+	code := ""
+
+	// Finding the code of an error response buffers its body.
+	if this.Metrics != nil || this.Tracer != nil {
+		code = responseCode(resp, err)
+	}
+
+	if this.Metrics != nil {
+		this.Metrics.RequestDone(operation, code, time.Since(start))
+	}
+
+	if code != "" {
+		span := operationSpan(request.Context())
+		span.SetAttribute("shelf.error_code", code)
+
+		if err != nil {
+			span.RecordError(err)
+		}
+	}
 
 	if err != nil {
+		if existing, ok := AsShelfError(err); ok {
+			return nil, existing
+		}
+
 		shelfErr = CreateShelfErrorFromError(err)
 
 		return nil, shelfErr
@@ -119,6 +255,113 @@ func (this *Request) PeformRequest(request *http.Request) (*http.Response, *Shel
 	return resp, shelfErr
 }
 
+// Authorizes and sends a request. If Shelf rejects a token from a
+// TokenSource, the source is refreshed and the request retried once
+// with the new token.
+func (this *Request) send(request *http.Request) (*http.Response, error) {
+	client := this.Client
+
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	err := this.authorize(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var doer Doer = client
+
+	if this.Log != nil {
+		doer = Logging(this.Log)(doer)
+	}
+
+	if this.Tracer != nil {
+		doer = this.traced(doer)
+	}
+
+	resp, err := doer.Do(request)
+
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && this.TokenSource != nil {
+		retry, retryErr := this.refreshAndRewind(request)
+
+		if retryErr != nil {
+			resp.Body.Close()
+			err = retryErr
+		} else if retry != nil {
+			resp.Body.Close()
+			resp, err = doer.Do(retry)
+		}
+	}
+
+	return resp, err
+}
+
+// Sets the Authorization header from the TokenSource, or ShelfToken.
+func (this *Request) authorize(request *http.Request) error {
+	token := this.ShelfToken
+
+	if this.TokenSource != nil {
+		var err error
+
+		token, err = this.TokenSource.Token(request)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	request.Header.Set("Authorization", token)
+
+	return nil
+}
+
+// Refreshes the TokenSource and returns a copy of the request that
+// can be sent again. Returns nil if the body cannot be replayed or
+// the token did not change, as Shelf would only reject it again.
+func (this *Request) refreshAndRewind(request *http.Request) (*http.Request, error) {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return nil, nil
+	}
+
+	err := this.TokenSource.Refresh()
+
+	if err != nil {
+		return nil, err
+	}
+
+	retry := request.Clone(request.Context())
+	err = this.authorize(retry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if retry.Header.Get("Authorization") == request.Header.Get("Authorization") {
+		return nil, nil
+	}
+
+	if request.GetBody != nil {
+		retry.Body, err = request.GetBody()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return retry, nil
+}
+
+// Context requests are created with.
+func (this *Request) context() context.Context {
+	if this.ctx == nil {
+		return context.Background()
+	}
+
+	return this.ctx
+}
+
 // Builds Shelf URL.
 func (this *Request) buildUrl(uri string, requestType string, property string) (string, error) {
 	parsedUri, err := url.Parse(uri)
@@ -1,10 +1,27 @@
 package shelflib
 
+// Matches the errors of a conditional update that finds the value
+// was changed by someone else. Compare with errors.Is.
+var ErrConflict error = codeError{code: CodeConflict, message: "Value was changed by another client."}
+
+// Sentinel that errors.Is matches with every ShelfError of its code.
+// A value, so that it cannot be changed for everyone who compares with it.
+type codeError struct {
+	code    string
+	message string
+}
+
+func (this codeError) Error() string {
+	return "Message: " + this.message + " Code: " + this.code
+}
+
 type ShelfError struct {
 	Code     string
 	HasError bool
 	Message  string
 	Parent   error
+	// HTTP status of the response the error came from, if any.
+	Status int
 }
 
 func CreateShelfErrorFromError(parent error) *ShelfError {
@@ -18,3 +35,24 @@ func CreateShelfError(message string, code string) *ShelfError {
 func (this *ShelfError) Error() string {
 	return "Message: " + this.Message + " Code: " + this.Code
 }
+
+// Allows errors.As to look at the error that caused this one.
+func (this *ShelfError) Unwrap() error {
+	return this.Parent
+}
+
+// Reports whether target is a ShelfError with the same code.
+// Allows errors.Is to be used with ErrConflict and friends.
+func (this *ShelfError) Is(target error) bool {
+	if sentinel, ok := target.(codeError); ok {
+		return this != nil && sentinel.code == this.Code
+	}
+
+	other, ok := target.(*ShelfError)
+
+	if !ok || this == nil || other == nil {
+		return false
+	}
+
+	return other.Code != "" && other.Code == this.Code
+}
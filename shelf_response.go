@@ -5,16 +5,22 @@ import (
 	"github.com/tomnomnom/linkheader"
 	"io"
 	"net/http"
+	"net/url"
 )
 
 var failureResponseMap map[int]string = map[int]string{
-	400: "bad_request",
-	401: "unauthorized",
-	403: "forbidden",
-	404: "resource_not_found",
-	500: "internal_server_error",
-	503: "service_unavailable",
-	504: "gateway_timeout",
+	400: CodeBadRequest,
+	401: CodeUnauthorized,
+	403: CodeForbidden,
+	404: CodeResourceNotFound,
+	405: CodeMethodNotAllowed,
+	409: CodeConflict,
+	412: CodePreconditionFailed,
+	429: CodeTooManyRequests,
+	500: CodeInternalServerError,
+	502: CodeBadGateway,
+	503: CodeServiceUnavailable,
+	504: CodeGatewayTimeout,
 }
 
 // Takes a response from Shelf and parses the links.
@@ -36,13 +42,9 @@ func ParseLinks(response *http.Response) (linkheader.Links, *ShelfError) {
 
 // Parses a response with an expected JSON body.
 func ParseJsonResponse(response *http.Response, result *interface{}) *ShelfError {
-	var shelfErr *ShelfError
-
-	err := CheckResponseStatus(response)
-
-	if err != nil {
-		shelfErr = CreateShelfErrorFromError(err)
+	shelfErr := CheckResponseStatus(response)
 
+	if shelfErr != nil {
 		return shelfErr
 	}
 
@@ -58,11 +60,9 @@ func ParseMetadataResponse(response *http.Response) (*MetadataProperty, *ShelfEr
 		result       *MetadataProperty
 		shelfErr     *ShelfError
 	)
-	err := ParseJsonResponse(response, &jsonResponse)
-
-	if err != nil {
-		shelfErr = CreateShelfErrorFromError(err)
+	shelfErr = ParseJsonResponse(response, &jsonResponse)
 
+	if shelfErr != nil {
 		return result, shelfErr
 	}
 
@@ -83,11 +83,9 @@ func ParseBulkMetadataResponse(response *http.Response) (map[string]*MetadataPro
 		shelfErr     *ShelfError
 	)
 
-	err := ParseJsonResponse(response, &jsonResponse)
-
-	if err != nil {
-		shelfErr = CreateShelfErrorFromError(err)
+	shelfErr = ParseJsonResponse(response, &jsonResponse)
 
+	if shelfErr != nil {
 		return result, shelfErr
 	}
 
@@ -115,6 +113,30 @@ func CreateMetadataProperty(name string, value string, immutable bool) *Metadata
 	return mappedMetadata
 }
 
+// Resolves a link returned by Shelf against the URL that was requested.
+// Shelf returns links relative to the host.
+func ResolveLinkUrl(base string, link linkheader.Link) (string, *ShelfError) {
+	var shelfErr *ShelfError
+
+	baseUrl, err := url.Parse(base)
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return "", shelfErr
+	}
+
+	linkUrl, err := url.Parse(link.URL)
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return "", shelfErr
+	}
+
+	return baseUrl.ResolveReference(linkUrl).String(), shelfErr
+}
+
 // Checks given response to see if it is an error response.
 // If it is it create a ShelfError.
 func CheckResponseStatus(response *http.Response) *ShelfError {
@@ -130,20 +152,21 @@ func CheckResponseStatus(response *http.Response) *ShelfError {
 	}
 
 	err := loadJsonBody(response.Body, &parsedBody)
+	body, _ := parsedBody.(map[string]interface{})
+	message, _ = body["message"].(string)
+	code, _ = body["code"].(string)
 
-	if err != nil {
-		if code, ok := failureResponseMap[response.StatusCode]; ok {
-			shelfErr = CreateShelfError("Failed Shelf response.", code)
-		} else {
-			shelfErr = CreateShelfError("Failed Shelf response.", "unknown_error")
-		}
-	} else {
-		body := parsedBody.(map[string]interface{})
-		message = body["message"].(string)
-		code = body["code"].(string)
-		shelfErr = CreateShelfError(message, code)
+	if err != nil || code == "" {
+		code = CodeForStatus(response.StatusCode)
+	}
+
+	if err != nil || message == "" {
+		message = "Failed Shelf response."
 	}
 
+	shelfErr = CreateShelfError(message, code)
+	shelfErr.Status = response.StatusCode
+
 	return shelfErr
 }
 
@@ -0,0 +1,425 @@
+// Package shelfcassette records HTTP interactions with Shelf to a file
+// and replays them, so that tests can run without network access.
+//
+// Record once against a real host:
+//
+//	recorder := shelfcassette.New("testdata/search.yaml", shelfcassette.ModeRecord)
+//	shelf.Request.Client = recorder.Client()
+//	...
+//	recorder.Save()
+//
+// Then replay in tests:
+//
+//	player, err := shelfcassette.Load("testdata/search.yaml")
+//	shelf.Request.Client = player.Client()
+package shelfcassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/not-nexus/shelf-lib-go"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type Mode int
+
+const (
+	// Requests are replayed from the cassette and never sent.
+	ModeReplay Mode = iota
+	// Requests are sent with Transport and added to the cassette.
+	ModeRecord
+)
+
+type Matching int
+
+const (
+	// Requests must be made in the recorded order with the
+	// same method, URL and body.
+	MatchStrict Matching = iota
+	// Requests may be made in any order and match on method and
+	// URL path alone. Once every match has been replayed the last
+	// one is replayed again, which suits polling.
+	MatchLenient
+)
+
+// Recorded request and the response it got.
+type Interaction struct {
+	Request  *Request  `yaml:"request"`
+	Response *Response `yaml:"response"`
+}
+
+type Request struct {
+	Method string      `yaml:"method"`
+	Url    string      `yaml:"url"`
+	Header http.Header `yaml:"header,omitempty"`
+	Body   *Body       `yaml:"body,omitempty"`
+	// Parts of a multipart form body. Kept instead of Body because
+	// the boundary is random and would never match.
+	Form []*FormPart `yaml:"form,omitempty"`
+}
+
+type Response struct {
+	Status int         `yaml:"status"`
+	Header http.Header `yaml:"header,omitempty"`
+	Body   *Body       `yaml:"body,omitempty"`
+}
+
+// Body kept as text when it is UTF-8, otherwise as base64.
+type Body struct {
+	Text   string `yaml:"text,omitempty"`
+	Base64 string `yaml:"base64,omitempty"`
+}
+
+type FormPart struct {
+	Name     string `yaml:"name"`
+	FileName string `yaml:"file_name,omitempty"`
+	Body     *Body  `yaml:"body,omitempty"`
+}
+
+// Records or replays interactions. Use it as the Transport of
+// the http.Client a ShelfLib sends requests with.
+type Cassette struct {
+	Path     string
+	Mode     Mode
+	Matching Matching
+	// Sends requests while recording. Defaults to http.DefaultTransport.
+	Transport    http.RoundTripper
+	Interactions []*Interaction
+	lock         sync.Mutex
+	replayed     []bool
+	next         int
+}
+
+// Keeps Cassette usable as a transport.
+var _ http.RoundTripper = (*Cassette)(nil)
+
+// Create an empty cassette that is saved to path.
+func New(path string, mode Mode) *Cassette {
+	return &Cassette{Path: path, Mode: mode}
+}
+
+// Load a cassette for replay.
+func Load(path string) (*Cassette, error) {
+	var interactions []*Interaction
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, &interactions)
+
+	if err != nil {
+		return nil, fmt.Errorf("shelfcassette: %s: %w", path, err)
+	}
+
+	cassette := New(path, ModeReplay)
+	cassette.Interactions = interactions
+
+	return cassette, nil
+}
+
+// Client that sends requests through the cassette.
+func (this *Cassette) Client() *http.Client {
+	return &http.Client{Transport: this}
+}
+
+// Write the interactions to Path.
+func (this *Cassette) Save() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	data, err := yaml.Marshal(this.Interactions)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(this.Path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file first so that a failed
+	// save does not leave a truncated cassette behind.
+	temp := this.Path + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, this.Path)
+}
+
+// Recorded interactions that have not been replayed.
+func (this *Cassette) Unplayed() []*Interaction {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	unplayed := make([]*Interaction, 0)
+
+	for i, interaction := range this.Interactions {
+		if i >= len(this.replayed) || !this.replayed[i] {
+			unplayed = append(unplayed, interaction)
+		}
+	}
+
+	return unplayed
+}
+
+func (this *Cassette) RoundTrip(request *http.Request) (*http.Response, error) {
+	recorded, outgoing, err := recordRequest(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if this.Mode == ModeRecord {
+		return this.record(outgoing, recorded)
+	}
+
+	interaction, err := this.find(recorded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return interaction.Response.toResponse(request), nil
+}
+
+// Sends the request and adds the interaction to the cassette.
+func (this *Cassette) record(request *http.Request, recorded *Request) (*http.Response, error) {
+	transport := this.Transport
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	response, err := transport.RoundTrip(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.Interactions = append(this.Interactions, &Interaction{
+		Request: recorded,
+		Response: &Response{
+			Status: response.StatusCode,
+			Header: shelflib.RedactHeaders(response.Header),
+			Body:   newBody(body),
+		},
+	})
+
+	return response, nil
+}
+
+// Finds the interaction to replay for a request.
+func (this *Cassette) find(recorded *Request) (*Interaction, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for len(this.replayed) < len(this.Interactions) {
+		this.replayed = append(this.replayed, false)
+	}
+
+	if this.Matching == MatchStrict {
+		if this.next < len(this.Interactions) && strictMatch(this.Interactions[this.next].Request, recorded) {
+			this.replayed[this.next] = true
+			this.next++
+
+			return this.Interactions[this.next-1], nil
+		}
+
+		return nil, fmt.Errorf("shelfcassette: %s %s is not the next recorded request in %s", recorded.Method, recorded.Url, this.Path)
+	}
+
+	last := -1
+
+	for i, interaction := range this.Interactions {
+		if lenientMatch(interaction.Request, recorded) {
+			last = i
+
+			if !this.replayed[i] {
+				this.replayed[i] = true
+
+				return interaction, nil
+			}
+		}
+	}
+
+	if last >= 0 {
+		return this.Interactions[last], nil
+	}
+
+	return nil, fmt.Errorf("shelfcassette: no request matching %s %s in %s", recorded.Method, recorded.Url, this.Path)
+}
+
+// Copies a request the way it is kept in a cassette. The body is
+// read, so a clone carrying it is returned to send in its place,
+// as a RoundTripper must not modify the request.
+func recordRequest(request *http.Request) (*Request, *http.Request, error) {
+	recorded := &Request{
+		Method: request.Method,
+		Url:    shelflib.RedactUrl(request.URL),
+		Header: shelflib.RedactHeaders(request.Header),
+	}
+
+	if request.Body == nil || request.Body == http.NoBody {
+		return recorded, request, nil
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outgoing := request.Clone(request.Context())
+	outgoing.Body = ioutil.NopCloser(bytes.NewReader(body))
+	mediaType, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		recorded.Form, err = readForm(body, params["boundary"])
+
+		if err == nil {
+			recorded.Header.Set("Content-Type", mediaType)
+
+			return recorded, outgoing, nil
+		}
+	}
+
+	recorded.Body = newBody(body)
+
+	return recorded, outgoing, nil
+}
+
+func readForm(body []byte, boundary string) ([]*FormPart, error) {
+	form := make([]*FormPart, 0)
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	for {
+		part, err := reader.NextPart()
+
+		if err == io.EOF {
+			return form, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := ioutil.ReadAll(part)
+
+		if err != nil {
+			return nil, err
+		}
+
+		form = append(form, &FormPart{Name: part.FormName(), FileName: part.FileName(), Body: newBody(content)})
+	}
+}
+
+func newBody(data []byte) *Body {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if utf8.Valid(data) {
+		return &Body{Text: string(data)}
+	}
+
+	return &Body{Base64: base64.StdEncoding.EncodeToString(data)}
+}
+
+func (this *Body) bytes() []byte {
+	if this == nil {
+		return nil
+	}
+
+	if this.Base64 != "" {
+		data, _ := base64.StdEncoding.DecodeString(this.Base64)
+
+		return data
+	}
+
+	return []byte(this.Text)
+}
+
+func (this *Response) toResponse(request *http.Request) *http.Response {
+	body := this.Body.bytes()
+	header := this.Header.Clone()
+
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", this.Status, http.StatusText(this.Status)),
+		StatusCode:    this.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+func strictMatch(recorded *Request, request *Request) bool {
+	return recorded.Method == request.Method &&
+		recorded.Url == request.Url &&
+		bytes.Equal(recorded.Body.bytes(), request.Body.bytes()) &&
+		reflect.DeepEqual(formBytes(recorded.Form), formBytes(request.Form))
+}
+
+func lenientMatch(recorded *Request, request *Request) bool {
+	recordedUrl, err := url.Parse(recorded.Url)
+
+	if err != nil {
+		return false
+	}
+
+	requestUrl, err := url.Parse(request.Url)
+
+	return err == nil && recorded.Method == request.Method && recordedUrl.Path == requestUrl.Path
+}
+
+// Form parts compared by name, file name and content.
+func formBytes(form []*FormPart) []string {
+	parts := make([]string, len(form))
+
+	for i, part := range form {
+		parts[i] = part.Name + "\x00" + part.FileName + "\x00" + string(part.Body.bytes())
+	}
+
+	return parts
+}
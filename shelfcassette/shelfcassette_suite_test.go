@@ -0,0 +1,13 @@
+package shelfcassette_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShelfcassette(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shelfcassette Suite")
+}
@@ -0,0 +1,135 @@
+package shelfcassette_test
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelfcassette"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("Cassette", func() {
+	var (
+		dir          string
+		cassettePath string
+		artifactUrl  string
+		directoryUrl string
+	)
+
+	// Runs the calls the cassette is recorded from.
+	run := func(shelf *shelflib.ShelfLib) {
+		Expect(shelf.UploadArtifact(artifactUrl, strings.NewReader("contents"))).To(BeNil())
+		links, err := shelf.ListArtifact(directoryUrl)
+		Expect(err).To(BeNil())
+		Expect(*links).To(HaveLen(1))
+		Expect((*links)[0].URL).To(Equal("/test/artifact/dir/thing"))
+		metadata, err := shelf.GetMetadata(artifactUrl)
+		Expect(err).To(BeNil())
+		Expect(metadata["md5Hash"].Value).To(Equal("98bf7d8c15784f0a3d63204441e1e2aa"))
+	}
+
+	replayer := func(matching shelfcassette.Matching) *shelflib.ShelfLib {
+		cassette, err := shelfcassette.Load(cassettePath)
+		Expect(err).ShouldNot(HaveOccurred())
+		cassette.Matching = matching
+		shelf := shelflib.New("OTHERTOKEN", nil)
+		shelf.Request.Client = cassette.Client()
+
+		return shelf
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "shelfcassette")
+		Expect(err).ShouldNot(HaveOccurred())
+		cassettePath = filepath.Join(dir, "cassettes", "upload.yaml")
+
+		server := shelftest.NewServer("SECRETTOKEN")
+		defer server.Close()
+		artifactUrl = server.ArtifactUrl("test", "dir/thing")
+		directoryUrl = server.ArtifactUrl("test", "dir/")
+
+		recorder := shelfcassette.New(cassettePath, shelfcassette.ModeRecord)
+		shelf := server.NewShelf("SECRETTOKEN")
+		recorder.Transport = shelf.Request.Client.Transport
+		shelf.Request.Client = recorder.Client()
+		run(shelf)
+		Expect(recorder.Save()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should scrub the Authorization header", func() {
+		data, err := ioutil.ReadFile(cassettePath)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(data)).ShouldNot(ContainSubstring("SECRETTOKEN"))
+		Expect(string(data)).To(ContainSubstring("REDACTED"))
+	})
+
+	It("should keep multipart bodies as form parts", func() {
+		cassette, err := shelfcassette.Load(cassettePath)
+		Expect(err).ShouldNot(HaveOccurred())
+		upload := cassette.Interactions[0].Request
+		Expect(upload.Body).To(BeNil())
+		Expect(upload.Form).To(HaveLen(1))
+		Expect(upload.Form[0].Name).To(Equal("file"))
+		Expect(upload.Form[0].FileName).To(Equal("thing"))
+		Expect(upload.Form[0].Body.Text).To(Equal("contents"))
+	})
+
+	It("should not modify the requests it is given", func() {
+		cassette, err := shelfcassette.Load(cassettePath)
+		Expect(err).ShouldNot(HaveOccurred())
+		request, _ := http.NewRequest("POST", artifactUrl, strings.NewReader("contents"))
+		body := request.Body
+
+		cassette.RoundTrip(request)
+		Expect(request.Body).To(BeIdenticalTo(body))
+	})
+
+	It("should replay the recorded interactions after the server is gone", func() {
+		run(replayer(shelfcassette.MatchStrict))
+	})
+
+	It("should reject requests out of order when strict", func() {
+		shelf := replayer(shelfcassette.MatchStrict)
+		_, err := shelf.GetMetadata(artifactUrl)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Message).To(ContainSubstring("is not the next recorded request"))
+	})
+
+	It("should reject a different upload when strict", func() {
+		shelf := replayer(shelfcassette.MatchStrict)
+		Expect(shelf.UploadArtifact(artifactUrl, strings.NewReader("other"))).ShouldNot(BeNil())
+	})
+
+	It("should replay requests in any order when lenient", func() {
+		shelf := replayer(shelfcassette.MatchLenient)
+
+		for i := 0; i < 2; i++ {
+			metadata, err := shelf.GetMetadata(artifactUrl)
+			Expect(err).To(BeNil())
+			Expect(metadata).To(HaveKey("sha256Hash"))
+		}
+
+		_, err := shelf.GetMetadataProperty(artifactUrl, "md5Hash")
+		Expect(err.Message).To(ContainSubstring("no request matching GET"))
+	})
+
+	It("should report interactions that were not replayed", func() {
+		cassette, _ := shelfcassette.Load(cassettePath)
+		shelf := shelflib.New("", nil)
+		shelf.Request.Client = cassette.Client()
+		shelf.UploadArtifact(artifactUrl, strings.NewReader("contents"))
+
+		Expect(cassette.Unplayed()).To(HaveLen(2))
+	})
+})
@@ -4,6 +4,8 @@ import (
 	"github.com/tomnomnom/linkheader"
 	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 )
 
@@ -16,29 +18,64 @@ type SearchCriteria struct {
 
 // Wrapper for Shelf metadata property.
 type MetadataProperty struct {
-	Name      string
-	Value     string
-	Immutable bool
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Immutable bool   `json:"immutable"`
 }
 
+// Metadata properties Shelf sets on every uploaded artifact.
+// They are all immutable.
+const (
+	PropertyArtifactName = "artifactName"
+	PropertyArtifactPath = "artifactPath"
+	PropertyMd5Hash      = "md5Hash"
+	PropertySha256Hash   = "sha256Hash"
+	PropertyCreatedDate  = "createdDate"
+)
+
 // Interface for interacting with Shelf.
 type ShelfLib struct {
 	Logger  *log.Logger
 	Request *Request
+	// Used when retrying conditional updates.
+	Backoff *Backoff
+	// Minimum level of what is logged to Logger. Defaults to warn,
+	// so that only failed requests are logged. Set it to info to
+	// log every request.
+	LogLevel *slog.LevelVar
 }
 
-// Create a ShelfLib instance.
+// Create a ShelfLib instance. Failed requests are logged to logger.
 func New(shelfToken string, logger *log.Logger) *ShelfLib {
-	request := &Request{Logger: logger, ShelfToken: shelfToken}
+	logLevel := &slog.LevelVar{}
+	logLevel.Set(slog.LevelWarn)
+	request := &Request{Logger: logger, ShelfToken: shelfToken, Log: slog.New(NewLogHandler(logger, logLevel))}
+
+	return &ShelfLib{Logger: logger, Request: request, Backoff: DefaultBackoff, LogLevel: logLevel}
+}
 
-	return &ShelfLib{Logger: logger, Request: request}
+// Log requests to a structured logger instead of Logger.
+func (this *ShelfLib) SetLogger(logger *slog.Logger) {
+	this.Request.Log = logger
+}
+
+// Create a ShelfLib instance that asks tokenSource for
+// the token of every request.
+func NewWithTokenSource(tokenSource TokenSource, logger *log.Logger) *ShelfLib {
+	shelfLib := New("", logger)
+	shelfLib.Request.TokenSource = tokenSource
+
+	return shelfLib
 }
 
 // Download artifact from Shelf.
 func (this *ShelfLib) DownloadArtifact(path string) (*io.ReadCloser, *ShelfError) {
-	response, err := this.Request.DoRequest("GET", path, "artifact", "", nil)
+	shelfLib, end := this.operation("DownloadArtifact")
+	response, err := shelfLib.Request.DoRequest("GET", path, "artifact", "", nil)
 
 	if err != nil {
+		end()
+
 		return nil, err
 	}
 
@@ -47,9 +84,26 @@ func (this *ShelfLib) DownloadArtifact(path string) (*io.ReadCloser, *ShelfError
 	err = CheckResponseStatus(response)
 
 	if err != nil {
+		end()
+
 		return nil, err
 	}
 
+	// The operation lasts until the caller is done with the body.
+	metrics := this.Request.Metrics
+	span := operationSpan(shelfLib.Context())
+	response.Body = &countingReadCloser{ReadCloser: response.Body, done: func(count int64, readErr error) {
+		if metrics != nil {
+			metrics.Transferred("DownloadArtifact", DirectionDownload, count)
+		}
+
+		if readErr != nil {
+			span.RecordError(readErr)
+		}
+
+		end()
+	}}
+
 	return &response.Body, err
 }
 
@@ -61,6 +115,7 @@ func (this *ShelfLib) DownloadArtifactToFile(path string, filePath string) *Shel
 		return shelfErr
 	}
 
+	defer (*resp).Close()
 	outFile, err := os.Create(filePath)
 
 	if err != nil {
@@ -89,7 +144,10 @@ func (this *ShelfLib) ListArtifact(path string) (*linkheader.Links, *ShelfError)
 		err   *ShelfError
 	)
 
-	response, err := this.Request.DoRequest("HEAD", path, "artifact", "", nil)
+	request, end := this.requestFor("ListArtifact")
+	defer end()
+
+	response, err := request.DoRequest("HEAD", path, "artifact", "", nil)
 
 	if err != nil {
 		return &links, err
@@ -116,7 +174,10 @@ func (this *ShelfLib) ListArtifact(path string) (*linkheader.Links, *ShelfError)
 
 // Upload an artifact from Shelf.
 func (this *ShelfLib) UploadArtifact(path string, reader io.Reader) *ShelfError {
-	response, err := this.Request.Upload(path, reader)
+	request, end := this.requestFor("UploadArtifact")
+	defer end()
+
+	response, err := request.Upload(path, reader)
 
 	if err != nil {
 		return err
@@ -144,13 +205,19 @@ func (this *ShelfLib) UploadArtifactFromFile(path string, filePath string) *Shel
 func (this *ShelfLib) Search(path string, searchCriteria *SearchCriteria) (*linkheader.Links, *ShelfError) {
 	var links linkheader.Links
 
-	data, err := this.Request.MarshalRequestData(searchCriteria)
+	request, end := this.requestFor("Search")
+	defer end()
+
+	// A search is sent as a POST but only reads.
+	request.ctx = withIdempotent(request.context())
+
+	data, err := request.MarshalRequestData(searchCriteria)
 
 	if err != nil {
 		return &links, err
 	}
 
-	response, err := this.Request.DoRequest("POST", path, "search", "", data)
+	response, err := request.DoRequest("POST", path, "search", "", data)
 
 	if err != nil {
 		return &links, err
@@ -165,7 +232,10 @@ func (this *ShelfLib) Search(path string, searchCriteria *SearchCriteria) (*link
 func (this *ShelfLib) GetMetadata(path string) (map[string]*MetadataProperty, *ShelfError) {
 	var responseMeta map[string]*MetadataProperty
 
-	response, err := this.Request.DoRequest("GET", path, "meta", "", nil)
+	request, end := this.requestFor("GetMetadata")
+	defer end()
+
+	response, err := request.DoRequest("GET", path, "meta", "", nil)
 
 	if err != nil {
 		return responseMeta, err
@@ -178,7 +248,10 @@ func (this *ShelfLib) GetMetadata(path string) (map[string]*MetadataProperty, *S
 func (this *ShelfLib) GetMetadataProperty(path string, propertyKey string) (*MetadataProperty, *ShelfError) {
 	var responseMeta *MetadataProperty
 
-	response, err := this.Request.DoRequest("GET", path, "meta", propertyKey, nil)
+	request, end := this.requestFor("GetMetadataProperty")
+	defer end()
+
+	response, err := request.DoRequest("GET", path, "meta", propertyKey, nil)
 
 	if err != nil {
 		return responseMeta, err
@@ -191,13 +264,16 @@ func (this *ShelfLib) GetMetadataProperty(path string, propertyKey string) (*Met
 func (this *ShelfLib) UpdateMetadata(path string, metadata map[string]*MetadataProperty) (map[string]*MetadataProperty, *ShelfError) {
 	var responseMeta map[string]*MetadataProperty
 
-	data, err := this.Request.MarshalRequestData(metadata)
+	request, end := this.requestFor("UpdateMetadata")
+	defer end()
+
+	data, err := request.MarshalRequestData(metadata)
 
 	if err != nil {
 		return responseMeta, err
 	}
 
-	response, err := this.Request.DoRequest("PUT", path, "meta", "", data)
+	response, err := request.DoRequest("PUT", path, "meta", "", data)
 
 	if err != nil {
 		return responseMeta, err
@@ -210,13 +286,16 @@ func (this *ShelfLib) UpdateMetadata(path string, metadata map[string]*MetadataP
 func (this *ShelfLib) UpdateMetadataProperty(path string, metadata *MetadataProperty) (*MetadataProperty, *ShelfError) {
 	var responseMeta *MetadataProperty
 
-	data, err := this.Request.MarshalRequestData(metadata)
+	request, end := this.requestFor("UpdateMetadataProperty")
+	defer end()
+
+	data, err := request.MarshalRequestData(metadata)
 
 	if err != nil {
 		return responseMeta, err
 	}
 
-	response, err := this.Request.DoRequest("PUT", path, "meta", metadata.Name, data)
+	response, err := request.DoRequest("PUT", path, "meta", metadata.Name, data)
 
 	if err != nil {
 		return responseMeta, err
@@ -225,17 +304,90 @@ func (this *ShelfLib) UpdateMetadataProperty(path string, metadata *MetadataProp
 	return ParseMetadataResponse(response)
 }
 
+// Update metadata property only if its current value is expectedValue.
+// Returns ErrConflict, along with the current property, if it is not.
+// When Shelf returns an ETag the update is sent with If-Match and
+// retried with backoff if the property changes in between.
+func (this *ShelfLib) UpdateMetadataPropertyIf(path string, name string, expectedValue string, newValue string) (*MetadataProperty, *ShelfError) {
+	shelfRequest, end := this.requestFor("UpdateMetadataPropertyIf")
+	defer end()
+
+	backoff := this.Backoff
+
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := shelfRequest.DoRequest("GET", path, "meta", name, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		etag := response.Header.Get("ETag")
+		current, err := ParseMetadataResponse(response)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if current.Value != expectedValue {
+			return current, CreateShelfError("Metadata property "+name+" is "+current.Value+", expected "+expectedValue+".", CodeConflict)
+		}
+
+		data, err := shelfRequest.MarshalRequestData(CreateMetadataProperty(name, newValue, current.Immutable))
+
+		if err != nil {
+			return nil, err
+		}
+
+		request, err := shelfRequest.NewRequest("PUT", path, "meta", name, data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if etag != "" {
+			request.Header.Set("If-Match", etag)
+		}
+
+		response, err = shelfRequest.PeformRequest(request)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode != http.StatusPreconditionFailed && response.StatusCode != http.StatusConflict {
+			return ParseMetadataResponse(response)
+		}
+
+		response.Body.Close()
+
+		if attempt+1 >= backoff.Attempts {
+			return nil, CreateShelfError("Metadata property "+name+" kept changing while being updated.", CodeConflict)
+		}
+
+		if waitErr := backoff.Wait(shelfRequest.context(), attempt); waitErr != nil {
+			return nil, CreateShelfErrorFromError(waitErr)
+		}
+	}
+}
+
 // Create metadata property. Will not update existing.
 func (this *ShelfLib) CreateMetadataProperty(path string, metadata *MetadataProperty) (*MetadataProperty, *ShelfError) {
 	var responseMeta *MetadataProperty
 
-	data, err := this.Request.MarshalRequestData(metadata)
+	request, end := this.requestFor("CreateMetadataProperty")
+	defer end()
+
+	data, err := request.MarshalRequestData(metadata)
 
 	if err != nil {
 		return responseMeta, err
 	}
 
-	response, err := this.Request.DoRequest("POST", path, "meta", metadata.Name, data)
+	response, err := request.DoRequest("POST", path, "meta", metadata.Name, data)
 
 	if err != nil {
 		return responseMeta, err
@@ -243,3 +395,57 @@ func (this *ShelfLib) CreateMetadataProperty(path string, metadata *MetadataProp
 
 	return ParseMetadataResponse(response)
 }
+
+// Delete metadata property for an artifact.
+func (this *ShelfLib) DeleteMetadataProperty(path string, propertyKey string) *ShelfError {
+	request, end := this.requestFor("DeleteMetadataProperty")
+	defer end()
+
+	response, err := request.DoRequest("DELETE", path, "meta", propertyKey, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return CheckResponseStatus(response)
+}
+
+// Delete several metadata properties for an artifact. Properties that
+// are immutable or do not exist are not sent to Shelf. Returns the
+// properties that could not be removed along with why.
+func (this *ShelfLib) DeleteMetadataProperties(path string, propertyKeys []string) (map[string]*ShelfError, *ShelfError) {
+	var failures = make(map[string]*ShelfError)
+
+	shelfLib, end := this.operation("DeleteMetadataProperties")
+	defer end()
+
+	metadata, err := shelfLib.GetMetadata(path)
+
+	if err != nil {
+		return failures, err
+	}
+
+	for _, key := range propertyKeys {
+		prop, ok := metadata[key]
+
+		if !ok {
+			failures[key] = CreateShelfError("Metadata property "+key+" does not exist.", CodeResourceNotFound)
+
+			continue
+		}
+
+		if prop.Immutable {
+			failures[key] = CreateShelfError("Metadata property "+key+" is immutable.", CodeForbiddenImmutableProperty)
+
+			continue
+		}
+
+		deleteErr := shelfLib.DeleteMetadataProperty(path, key)
+
+		if deleteErr != nil {
+			failures[key] = deleteErr
+		}
+	}
+
+	return failures, err
+}
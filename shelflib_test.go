@@ -1,6 +1,9 @@
 package shelflib_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/jarcoal/httpmock"
 	"github.com/not-nexus/shelf-lib-go"
 	. "github.com/onsi/ginkgo"
@@ -9,9 +12,12 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"path"
 	"strings"
+	"time"
 )
 
 var shelf *shelflib.ShelfLib
@@ -48,6 +54,11 @@ func assertRequest(request *http.Request) {
 	Expect(request.Header["Authorization"][0]).To(Equal(validToken))
 }
 
+// Decodes the JSON body of a request.
+func readJson(request *http.Request, result interface{}) error {
+	return json.NewDecoder(request.Body).Decode(result)
+}
+
 var _ = Describe("Shelflib", func() {
 	BeforeEach(func() {
 		shelf = shelflib.New(validToken, logger)
@@ -118,6 +129,13 @@ var _ = Describe("Shelflib", func() {
 			return httpmock.NewJsonResponse(200, response)
 		})
 
+		// Delete metadata property.
+		httpmock.RegisterResponder("DELETE", uriMap["meta"]+"/version", func(request *http.Request) (*http.Response, error) {
+			assertRequest(request)
+
+			return httpmock.NewStringResponse(204, ""), nil
+		})
+
 		// Search
 		httpmock.RegisterResponder("POST", uriMap["search"], func(request *http.Request) (*http.Response, error) {
 			response := httpmock.NewStringResponse(204, "")
@@ -149,6 +167,27 @@ var _ = Describe("Shelflib", func() {
 				err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader(fileContents))
 				Expect(err).ShouldNot(HaveOccurred())
 			})
+			It("should send a complete multipart form", func() {
+				httpmock.RegisterResponder("POST", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+					_, params, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+					Expect(err).ShouldNot(HaveOccurred())
+					reader := multipart.NewReader(request.Body, params["boundary"])
+					part, err := reader.NextPart()
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(part.FileName()).To(Equal(testPath))
+					content, err := ioutil.ReadAll(part)
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(string(content)).To(Equal("Simple Text File"))
+					// Only io.EOF once the closing boundary was read.
+					_, err = reader.NextPart()
+					Expect(err).To(Equal(io.EOF))
+
+					return httpmock.NewStringResponse(201, ""), nil
+				})
+
+				err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+				Expect(err).ShouldNot(HaveOccurred())
+			})
 		})
 		Context("UpdateMetadata", func() {
 			It("should successfully update artifact's metadata", func() {
@@ -194,6 +233,91 @@ var _ = Describe("Shelflib", func() {
 				Expect(res).To(Equal(version))
 			})
 		})
+		Context("UpdateMetadataPropertyIf", func() {
+			var (
+				status  string
+				etag    string
+				ifMatch []string
+			)
+
+			BeforeEach(func() {
+				status = "pending"
+				etag = `"1"`
+				ifMatch = []string{}
+				shelf.Backoff = &shelflib.Backoff{Attempts: 3}
+
+				httpmock.RegisterResponder("GET", uriMap["meta"]+"/status", func(request *http.Request) (*http.Response, error) {
+					response, _ := httpmock.NewJsonResponse(200, map[string]interface{}{"name": "status", "value": status, "immutable": false})
+					response.Header.Set("ETag", etag)
+
+					return response, nil
+				})
+				httpmock.RegisterResponder("PUT", uriMap["meta"]+"/status", func(request *http.Request) (*http.Response, error) {
+					ifMatch = append(ifMatch, request.Header.Get("If-Match"))
+
+					if request.Header.Get("If-Match") != etag {
+						return httpmock.NewStringResponse(412, ""), nil
+					}
+
+					return httpmock.NewJsonResponse(200, map[string]interface{}{"name": "status", "value": "released", "immutable": false})
+				})
+			})
+
+			It("updates when the value matches", func() {
+				res, err := shelf.UpdateMetadataPropertyIf(uriMap["artifact"], "status", "pending", "released")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(res.Value).To(Equal("released"))
+				Expect(ifMatch).To(Equal([]string{`"1"`}))
+			})
+			It("returns a conflict when the value does not match", func() {
+				status = "failed"
+				res, err := shelf.UpdateMetadataPropertyIf(uriMap["artifact"], "status", "pending", "released")
+				Expect(errors.Is(err, shelflib.ErrConflict)).To(BeTrue())
+				Expect(res.Value).To(Equal("failed"))
+				Expect(ifMatch).To(BeEmpty())
+			})
+			It("retries when the property changes in between", func() {
+				etag = `"2"`
+				httpmock.RegisterResponder("PUT", uriMap["meta"]+"/status", func(request *http.Request) (*http.Response, error) {
+					ifMatch = append(ifMatch, request.Header.Get("If-Match"))
+
+					if len(ifMatch) == 1 {
+						return httpmock.NewStringResponse(412, ""), nil
+					}
+
+					return httpmock.NewJsonResponse(200, map[string]interface{}{"name": "status", "value": "released", "immutable": false})
+				})
+				res, err := shelf.UpdateMetadataPropertyIf(uriMap["artifact"], "status", "pending", "released")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(res.Value).To(Equal("released"))
+				Expect(ifMatch).To(HaveLen(2))
+			})
+			It("gives up after the configured attempts", func() {
+				httpmock.RegisterResponder("PUT", uriMap["meta"]+"/status", func(request *http.Request) (*http.Response, error) {
+					ifMatch = append(ifMatch, request.Header.Get("If-Match"))
+
+					return httpmock.NewStringResponse(412, ""), nil
+				})
+				_, err := shelf.UpdateMetadataPropertyIf(uriMap["artifact"], "status", "pending", "released")
+				Expect(errors.Is(err, shelflib.ErrConflict)).To(BeTrue())
+				Expect(ifMatch).To(HaveLen(3))
+			})
+			It("stops waiting to retry once the context is done", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				shelf.Backoff = &shelflib.Backoff{Attempts: 3, Initial: time.Hour, Max: time.Hour}
+				httpmock.RegisterResponder("PUT", uriMap["meta"]+"/status", func(request *http.Request) (*http.Response, error) {
+					cancel()
+
+					return httpmock.NewStringResponse(412, ""), nil
+				})
+				_, err := shelf.WithContext(ctx).UpdateMetadataPropertyIf(uriMap["artifact"], "status", "pending", "released")
+				Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			})
+			It("matches conflicts by code only", func() {
+				Expect(errors.Is(shelflib.CreateShelfError("Other message.", shelflib.CodeConflict), shelflib.ErrConflict)).To(BeTrue())
+				Expect(errors.Is(shelflib.CreateShelfError("Value was changed by another client.", shelflib.CodeBadRequest), shelflib.ErrConflict)).To(BeFalse())
+			})
+		})
 		Context("CreateMetadataProperty", func() {
 			It("successfully creates a metadata property", func() {
 				metadata := &shelflib.MetadataProperty{"stuff", "monoamine-oxidase-inhibitor", true}
@@ -202,6 +326,28 @@ var _ = Describe("Shelflib", func() {
 				Expect(res).To(Equal(metadata))
 			})
 		})
+		Context("DeleteMetadataProperty", func() {
+			It("successfully deletes a metadata property", func() {
+				err := shelf.DeleteMetadataProperty(uriMap["artifact"], "version")
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+		Context("DeleteMetadataProperties", func() {
+			It("reports properties that could not be deleted", func() {
+				metadata := map[string]map[string]interface{}{
+					"version": map[string]interface{}{"value": "1.5", "immutable": false},
+					"md5Hash": map[string]interface{}{"value": "abc", "immutable": true},
+				}
+				httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+					return httpmock.NewJsonResponse(200, metadata)
+				})
+				failures, err := shelf.DeleteMetadataProperties(uriMap["artifact"], []string{"version", "md5Hash", "missing"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(failures).To(HaveLen(2))
+				Expect(failures["md5Hash"].Code).To(Equal("forbidden_immutable_property"))
+				Expect(failures["missing"].Code).To(Equal("resource_not_found"))
+			})
+		})
 		Context("Search", func() {
 			It("successfully searches", func() {
 				expectedLinks := linkheader.Parse(testLink)
@@ -0,0 +1,207 @@
+package shelfmock
+
+import (
+	"errors"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/tomnomnom/linkheader"
+	"io"
+	"sort"
+	"strings"
+)
+
+func (this *Client) DownloadArtifact(path string) (*io.ReadCloser, *shelflib.ShelfError) {
+	results := this.called("DownloadArtifact", path)
+	body, _ := results.get(0).(*io.ReadCloser)
+
+	return body, results.shelfError(1)
+}
+
+func (this *Client) DownloadArtifactToFile(path string, filePath string) *shelflib.ShelfError {
+	return this.called("DownloadArtifactToFile", path, filePath).shelfError(0)
+}
+
+func (this *Client) ListArtifact(path string) (*linkheader.Links, *shelflib.ShelfError) {
+	results := this.called("ListArtifact", path)
+	links, _ := results.get(0).(*linkheader.Links)
+
+	return links, results.shelfError(1)
+}
+
+func (this *Client) UploadArtifact(path string, reader io.Reader) *shelflib.ShelfError {
+	return this.called("UploadArtifact", path, reader).shelfError(0)
+}
+
+func (this *Client) UploadArtifactFromFile(path string, filePath string) *shelflib.ShelfError {
+	return this.called("UploadArtifactFromFile", path, filePath).shelfError(0)
+}
+
+func (this *Client) UploadArtifactOnce(path string, reader io.Reader, opts *shelflib.UploadOptions) (bool, *shelflib.ShelfError) {
+	results := this.called("UploadArtifactOnce", path, reader, opts)
+	uploaded, _ := results.get(0).(bool)
+
+	return uploaded, results.shelfError(1)
+}
+
+func (this *Client) UploadArtifactFromFileOnce(path string, filePath string, opts *shelflib.UploadOptions) (bool, *shelflib.ShelfError) {
+	results := this.called("UploadArtifactFromFileOnce", path, filePath, opts)
+	uploaded, _ := results.get(0).(bool)
+
+	return uploaded, results.shelfError(1)
+}
+
+func (this *Client) CopyArtifact(src string, dst string, opts *shelflib.CopyOptions) *shelflib.ShelfError {
+	return this.called("CopyArtifact", src, dst, opts).shelfError(0)
+}
+
+func (this *Client) Publish(path string, reader io.Reader, metadata map[string]*shelflib.MetadataProperty, opts *shelflib.PublishOptions) *shelflib.ShelfError {
+	return this.called("Publish", path, reader, metadata, opts).shelfError(0)
+}
+
+func (this *Client) UploadDirectory(localDir string, remotePrefix string, opts *shelflib.UploadDirectoryOptions) (*shelflib.TransferReport, *shelflib.ShelfError) {
+	results := this.called("UploadDirectory", localDir, remotePrefix, opts)
+	report, _ := results.get(0).(*shelflib.TransferReport)
+
+	return report, results.shelfError(1)
+}
+
+func (this *Client) DownloadDirectory(remotePrefix string, localDir string, opts *shelflib.DownloadDirectoryOptions) (*shelflib.TransferReport, *shelflib.ShelfError) {
+	results := this.called("DownloadDirectory", remotePrefix, localDir, opts)
+	report, _ := results.get(0).(*shelflib.TransferReport)
+
+	return report, results.shelfError(1)
+}
+
+// Calls walk with each stubbed record in order of path, leaving out
+// directories walk skips. Stub with a map[string]*shelflib.ArtifactRecord
+// keyed by relative path.
+func (this *Client) Walk(prefix string, walk shelflib.WalkFunc) *shelflib.ShelfError {
+	results := this.called("Walk", prefix, walk)
+	records, _ := results.get(0).(map[string]*shelflib.ArtifactRecord)
+	paths := make([]string, 0, len(records))
+
+	for relativePath := range records {
+		paths = append(paths, relativePath)
+	}
+
+	sort.Strings(paths)
+	skipped := ""
+
+	for _, relativePath := range paths {
+		if skipped != "" && strings.HasPrefix(relativePath, skipped) {
+			continue
+		}
+
+		err := walk(relativePath, records[relativePath])
+
+		if errors.Is(err, shelflib.ErrSkipDirectory) {
+			skipped = relativePath + "/"
+		} else if shelfErr, ok := shelflib.AsShelfError(err); ok {
+			return shelfErr
+		} else if err != nil {
+			return shelflib.CreateShelfErrorFromError(err)
+		}
+	}
+
+	return results.shelfError(1)
+}
+
+func (this *Client) Sync(localDir string, remotePrefix string, opts *shelflib.SyncOptions) (*shelflib.SyncReport, *shelflib.ShelfError) {
+	results := this.called("Sync", localDir, remotePrefix, opts)
+	report, _ := results.get(0).(*shelflib.SyncReport)
+
+	return report, results.shelfError(1)
+}
+
+func (this *Client) Mirror(srcPrefix string, dstPrefix string, opts *shelflib.MirrorOptions) (*shelflib.MirrorReport, *shelflib.ShelfError) {
+	results := this.called("Mirror", srcPrefix, dstPrefix, opts)
+	report, _ := results.get(0).(*shelflib.MirrorReport)
+
+	return report, results.shelfError(1)
+}
+
+func (this *Client) Search(path string, searchCriteria *shelflib.SearchCriteria) (*linkheader.Links, *shelflib.ShelfError) {
+	results := this.called("Search", path, searchCriteria)
+	links, _ := results.get(0).(*linkheader.Links)
+
+	return links, results.shelfError(1)
+}
+
+func (this *Client) GetMetadata(path string) (map[string]*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("GetMetadata", path)
+	metadata, _ := results.get(0).(map[string]*shelflib.MetadataProperty)
+
+	return metadata, results.shelfError(1)
+}
+
+func (this *Client) GetMetadataProperty(path string, propertyKey string) (*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("GetMetadataProperty", path, propertyKey)
+	prop, _ := results.get(0).(*shelflib.MetadataProperty)
+
+	return prop, results.shelfError(1)
+}
+
+// Decodes stubbed metadata into v, so that it can be
+// stubbed the same way as GetMetadata.
+func (this *Client) GetMetadataInto(path string, v interface{}) *shelflib.ShelfError {
+	results := this.called("GetMetadataInto", path, v)
+	metadata, ok := results.get(0).(map[string]*shelflib.MetadataProperty)
+
+	if ok && results.shelfError(1) == nil {
+		return shelflib.DecodeMetadata(metadata, v)
+	}
+
+	return results.shelfError(1)
+}
+
+func (this *Client) UpdateMetadata(path string, metadata map[string]*shelflib.MetadataProperty) (map[string]*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("UpdateMetadata", path, metadata)
+	updated, _ := results.get(0).(map[string]*shelflib.MetadataProperty)
+
+	return updated, results.shelfError(1)
+}
+
+func (this *Client) UpdateMetadataFrom(path string, v interface{}) (map[string]*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("UpdateMetadataFrom", path, v)
+	updated, _ := results.get(0).(map[string]*shelflib.MetadataProperty)
+
+	return updated, results.shelfError(1)
+}
+
+func (this *Client) UpdateMetadataProperty(path string, metadata *shelflib.MetadataProperty) (*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("UpdateMetadataProperty", path, metadata)
+	prop, _ := results.get(0).(*shelflib.MetadataProperty)
+
+	return prop, results.shelfError(1)
+}
+
+func (this *Client) UpdateMetadataPropertyIf(path string, name string, expectedValue string, newValue string) (*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("UpdateMetadataPropertyIf", path, name, expectedValue, newValue)
+	prop, _ := results.get(0).(*shelflib.MetadataProperty)
+
+	return prop, results.shelfError(1)
+}
+
+func (this *Client) CreateMetadataProperty(path string, metadata *shelflib.MetadataProperty) (*shelflib.MetadataProperty, *shelflib.ShelfError) {
+	results := this.called("CreateMetadataProperty", path, metadata)
+	prop, _ := results.get(0).(*shelflib.MetadataProperty)
+
+	return prop, results.shelfError(1)
+}
+
+func (this *Client) DeleteMetadataProperty(path string, propertyKey string) *shelflib.ShelfError {
+	return this.called("DeleteMetadataProperty", path, propertyKey).shelfError(0)
+}
+
+func (this *Client) DeleteMetadataProperties(path string, propertyKeys []string) (map[string]*shelflib.ShelfError, *shelflib.ShelfError) {
+	results := this.called("DeleteMetadataProperties", path, propertyKeys)
+	failures, _ := results.get(0).(map[string]*shelflib.ShelfError)
+
+	return failures, results.shelfError(1)
+}
+
+func (this *Client) ApplyMetadata(path string, desired map[string]*shelflib.MetadataProperty, opts *shelflib.ApplyMetadataOptions) (*shelflib.MetadataReport, *shelflib.ShelfError) {
+	results := this.called("ApplyMetadata", path, desired, opts)
+	report, _ := results.get(0).(*shelflib.MetadataReport)
+
+	return report, results.shelfError(1)
+}
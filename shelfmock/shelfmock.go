@@ -0,0 +1,298 @@
+// Package shelfmock provides a shelflib.ShelfClient that records
+// calls and returns stubbed results, for use with Ginkgo and Gomega.
+//
+//	client := shelfmock.New()
+//	client.On("GetMetadata", HavePrefix("https://")).Return(metadata, nil)
+//	...
+//	Expect(client).To(shelfmock.HaveReceived("GetMetadata", url))
+//	Expect(client.Verify()).To(Succeed())
+package shelfmock
+
+import (
+	"fmt"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"strings"
+	"sync"
+)
+
+// A call made to the mock.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+func (this *Call) String() string {
+	args := make([]string, len(this.Args))
+
+	for i, arg := range this.Args {
+		args[i] = fmt.Sprintf("%#v", arg)
+	}
+
+	return this.Method + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Results returned for calls to a method with matching arguments.
+type Stub struct {
+	method  string
+	args    []interface{}
+	results []interface{}
+	do      func(args []interface{}) []interface{}
+	times   int
+	calls   int
+}
+
+// Results, in the order the method returns them. Missing
+// results are zero values.
+func (this *Stub) Return(results ...interface{}) *Stub {
+	this.results = results
+
+	return this
+}
+
+// Computes the results from the arguments instead.
+func (this *Stub) Do(do func(args []interface{}) []interface{}) *Stub {
+	this.do = do
+
+	return this
+}
+
+// Expect exactly times calls. Checked by Verify. Once the
+// stub has been called times times it no longer matches.
+func (this *Stub) Times(times int) *Stub {
+	this.times = times
+
+	return this
+}
+
+// Expect a single call.
+func (this *Stub) Once() *Stub {
+	return this.Times(1)
+}
+
+// Matches arguments either with the Gomega matcher given
+// for them or by equality.
+func (this *Stub) matches(method string, args []interface{}) bool {
+	if this.method != method || len(this.args) > len(args) {
+		return false
+	}
+
+	if this.times > 0 && this.calls >= this.times {
+		return false
+	}
+
+	return argsMatch(this.args, args)
+}
+
+// Mock implementation of shelflib.ShelfClient.
+type Client struct {
+	lock       sync.Mutex
+	stubs      []*Stub
+	calls      []*Call
+	unexpected []*Call
+}
+
+// Keeps Client complete.
+var _ shelflib.ShelfClient = (*Client)(nil)
+
+func New() *Client {
+	return &Client{}
+}
+
+// Stub calls to method whose leading arguments match args.
+// Later stubs take precedence over earlier ones.
+func (this *Client) On(method string, args ...interface{}) *Stub {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	stub := &Stub{method: method, args: args}
+	this.stubs = append(this.stubs, stub)
+
+	return stub
+}
+
+// All calls made so far.
+func (this *Client) Calls() []*Call {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return append([]*Call{}, this.calls...)
+}
+
+// Calls made so far to method.
+func (this *Client) CallsTo(method string) []*Call {
+	calls := make([]*Call, 0)
+
+	for _, call := range this.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reports calls that matched no stub and stubs
+// that were not called the expected number of times.
+func (this *Client) Verify() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	problems := make([]string, 0)
+
+	for _, call := range this.unexpected {
+		problems = append(problems, "unexpected call "+call.String())
+	}
+
+	for _, stub := range this.stubs {
+		if stub.times > 0 && stub.calls != stub.times {
+			problems = append(problems, fmt.Sprintf("expected %d calls to %s, got %d", stub.times, stub.method, stub.calls))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("shelfmock: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Forget all stubs and calls.
+func (this *Client) Reset() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.stubs = nil
+	this.calls = nil
+	this.unexpected = nil
+}
+
+// Records a call and returns the results of the matching stub.
+// A call that matches no stub returns a ShelfError.
+func (this *Client) called(method string, args ...interface{}) *results {
+	this.lock.Lock()
+
+	call := &Call{Method: method, Args: args}
+	this.calls = append(this.calls, call)
+
+	for i := len(this.stubs) - 1; i >= 0; i-- {
+		stub := this.stubs[i]
+
+		if stub.matches(method, args) {
+			stub.calls++
+			this.lock.Unlock()
+
+			if stub.do != nil {
+				return &results{values: stub.do(args)}
+			}
+
+			return &results{values: stub.results}
+		}
+	}
+
+	this.unexpected = append(this.unexpected, call)
+	this.lock.Unlock()
+
+	return &results{err: shelflib.CreateShelfError("Unexpected call "+call.String()+".", shelflib.CodeUnknownError)}
+}
+
+// Results of a call, converted to the types the method returns.
+type results struct {
+	values []interface{}
+	// Returned as the method's error for unexpected calls.
+	err *shelflib.ShelfError
+}
+
+func (this *results) get(index int) interface{} {
+	if index < len(this.values) {
+		return this.values[index]
+	}
+
+	return nil
+}
+
+func (this *results) shelfError(index int) *shelflib.ShelfError {
+	if this.err != nil {
+		return this.err
+	}
+
+	shelfErr, _ := this.get(index).(*shelflib.ShelfError)
+
+	return shelfErr
+}
+
+// Succeeds if the client received a call to method whose
+// leading arguments match args.
+func HaveReceived(method string, args ...interface{}) types.GomegaMatcher {
+	return &receivedMatcher{method: method, args: args}
+}
+
+type receivedMatcher struct {
+	method string
+	args   []interface{}
+}
+
+func (this *receivedMatcher) Match(actual interface{}) (bool, error) {
+	client, ok := actual.(*Client)
+
+	if !ok {
+		return false, fmt.Errorf("HaveReceived expects a *shelfmock.Client, got %T", actual)
+	}
+
+	for _, call := range client.CallsTo(this.method) {
+		if len(this.args) <= len(call.Args) && argsMatch(this.args, call.Args) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (this *receivedMatcher) FailureMessage(actual interface{}) string {
+	return "Expected a call to " + this.describe() + ", got:\n" + describeCalls(actual)
+}
+
+func (this *receivedMatcher) NegatedFailureMessage(actual interface{}) string {
+	return "Expected no call to " + this.describe() + ", got:\n" + describeCalls(actual)
+}
+
+func (this *receivedMatcher) describe() string {
+	call := &Call{Method: this.method, Args: this.args}
+
+	return call.String()
+}
+
+func describeCalls(actual interface{}) string {
+	client, ok := actual.(*Client)
+
+	if !ok {
+		return fmt.Sprintf("%#v", actual)
+	}
+
+	lines := make([]string, 0)
+
+	for _, call := range client.Calls() {
+		lines = append(lines, "    "+call.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func argsMatch(expected []interface{}, actual []interface{}) bool {
+	for i, arg := range expected {
+		matcher, ok := arg.(types.GomegaMatcher)
+
+		if arg == nil {
+			matcher = gomega.BeNil()
+		} else if !ok {
+			matcher = gomega.Equal(arg)
+		}
+
+		if matched, err := matcher.Match(actual[i]); err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,13 @@
+package shelfmock_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShelfmock(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shelfmock Suite")
+}
@@ -0,0 +1,125 @@
+package shelfmock_test
+
+import (
+	"context"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelfmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tomnomnom/linkheader"
+	"time"
+)
+
+var artifactUrl = "https://api.shelf.cwscloud.net/test/artifact/thing"
+
+var _ = Describe("Client", func() {
+	var client *shelfmock.Client
+
+	BeforeEach(func() {
+		client = shelfmock.New()
+	})
+
+	It("should return stubbed results", func() {
+		metadata := map[string]*shelflib.MetadataProperty{"version": shelflib.CreateMetadataProperty("version", "1", false)}
+		client.On("GetMetadata", artifactUrl).Return(metadata, nil)
+
+		result, err := client.GetMetadata(artifactUrl)
+		Expect(err).To(BeNil())
+		Expect(result).To(Equal(metadata))
+	})
+
+	It("should match arguments with Gomega matchers", func() {
+		client.On("GetMetadataProperty", HaveSuffix("/thing"), "version").Return(shelflib.CreateMetadataProperty("version", "1", false))
+		client.On("GetMetadataProperty", HaveSuffix("/thing"), "missing").Return(nil, shelflib.CreateShelfError("Not found", shelflib.CodeResourceNotFound))
+
+		prop, err := client.GetMetadataProperty(artifactUrl, "version")
+		Expect(err).To(BeNil())
+		Expect(prop.Value).To(Equal("1"))
+		_, err = client.GetMetadataProperty(artifactUrl, "missing")
+		Expect(shelflib.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should compute results from arguments", func() {
+		client.On("UpdateMetadataProperty").Do(func(args []interface{}) []interface{} {
+			return []interface{}{args[1]}
+		})
+
+		prop := shelflib.CreateMetadataProperty("version", "2", false)
+		result, err := client.UpdateMetadataProperty(artifactUrl, prop)
+		Expect(err).To(BeNil())
+		Expect(result).To(BeIdenticalTo(prop))
+	})
+
+	It("should decode stubbed metadata into structs", func() {
+		var build struct {
+			Version string `shelf:"version"`
+		}
+
+		client.On("GetMetadataInto", artifactUrl).Return(map[string]*shelflib.MetadataProperty{
+			"version": shelflib.CreateMetadataProperty("version", "3", false),
+		})
+
+		Expect(client.GetMetadataInto(artifactUrl, &build)).To(BeNil())
+		Expect(build.Version).To(Equal("3"))
+	})
+
+	It("should walk stubbed records", func() {
+		client.On("Walk", artifactUrl).Return(map[string]*shelflib.ArtifactRecord{
+			"a":         {Title: "artifact"},
+			"skipped":   {Title: "directory"},
+			"skipped/b": {Title: "artifact"},
+			"z":         {Title: "artifact"},
+		})
+
+		walked := make([]string, 0)
+		err := client.Walk(artifactUrl, func(relativePath string, record *shelflib.ArtifactRecord) error {
+			walked = append(walked, relativePath)
+
+			if relativePath == "skipped" {
+				return shelflib.ErrSkipDirectory
+			}
+
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(walked).To(Equal([]string{"a", "skipped", "z"}))
+	})
+
+	It("should record calls", func() {
+		client.On("DeleteMetadataProperty")
+
+		Expect(client.DeleteMetadataProperty(artifactUrl, "version")).To(BeNil())
+		Expect(client).To(shelfmock.HaveReceived("DeleteMetadataProperty", artifactUrl, "version"))
+		Expect(client).ShouldNot(shelfmock.HaveReceived("DeleteMetadataProperty", artifactUrl, "build"))
+		Expect(client.CallsTo("DeleteMetadataProperty")).To(HaveLen(1))
+		Expect(client.Calls()[0].String()).To(Equal(`DeleteMetadataProperty("` + artifactUrl + `", "version")`))
+	})
+
+	It("should fail unexpected calls", func() {
+		err := client.UploadArtifactFromFile(artifactUrl, "/tmp/thing")
+		Expect(err.Code).To(Equal(shelflib.CodeUnknownError))
+		Expect(client.Verify()).To(MatchError(ContainSubstring(`unexpected call UploadArtifactFromFile`)))
+	})
+
+	It("should verify the number of calls", func() {
+		client.On("DownloadArtifactToFile").Times(2)
+
+		client.DownloadArtifactToFile(artifactUrl, "a")
+		Expect(client.Verify()).To(MatchError(ContainSubstring("expected 2 calls to DownloadArtifactToFile, got 1")))
+		client.DownloadArtifactToFile(artifactUrl, "b")
+		Expect(client.Verify()).To(Succeed())
+	})
+
+	It("should stand in for ShelfLib", func() {
+		links := linkheader.Parse(`</test/artifact/thing>; rel="item"; title="artifact"`)
+		client.On("Search").Return(&links, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		watcher := &shelflib.Watcher{Shelf: client, Path: "https://api.shelf.cwscloud.net/test/artifact/", Interval: time.Hour}
+		event := <-watcher.Start(ctx)
+
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactUrl))
+	})
+})
@@ -0,0 +1,90 @@
+// Package shelfotel reports shelflib spans to OpenTelemetry.
+package shelfotel
+
+import (
+	"context"
+	"fmt"
+	"github.com/not-nexus/shelf-lib-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Name of the OpenTelemetry tracer spans are created with.
+const InstrumentationName = "github.com/not-nexus/shelf-lib-go"
+
+// Implements shelflib.Tracer with an OpenTelemetry tracer.
+type Tracer struct {
+	Tracer trace.Tracer
+	// Injects headers into requests. Defaults to W3C trace context.
+	Propagator propagation.TextMapPropagator
+}
+
+// Create a Tracer that creates spans with provider and
+// propagates them with W3C traceparent headers.
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		Tracer:     provider.Tracer(InstrumentationName),
+		Propagator: propagation.TraceContext{},
+	}
+}
+
+func (this *Tracer) Start(ctx context.Context, name string) (context.Context, shelflib.Span) {
+	kind := trace.SpanKindInternal
+
+	// Request spans are named after the HTTP method.
+	if len(name) > 5 && name[:5] == "HTTP " {
+		kind = trace.SpanKindClient
+	}
+
+	ctx, span := this.Tracer.Start(ctx, name, trace.WithSpanKind(kind))
+
+	return ctx, &Span{Span: span}
+}
+
+func (this *Tracer) Inject(ctx context.Context, header http.Header) {
+	this.Propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Implements shelflib.Span with an OpenTelemetry span.
+type Span struct {
+	Span trace.Span
+}
+
+func (this *Span) SetAttribute(key string, value interface{}) {
+	this.Span.SetAttributes(Attribute(key, value))
+}
+
+func (this *Span) AddEvent(name string) {
+	this.Span.AddEvent(name)
+}
+
+func (this *Span) RecordError(err error) {
+	this.Span.RecordError(err)
+	this.Span.SetStatus(codes.Error, err.Error())
+}
+
+func (this *Span) End() {
+	this.Span.End()
+}
+
+// Converts an attribute value set by shelflib. Values
+// of other types are formatted as strings.
+func Attribute(key string, value interface{}) attribute.KeyValue {
+	switch typed := value.(type) {
+	case string:
+		return attribute.String(key, typed)
+	case bool:
+		return attribute.Bool(key, typed)
+	case int:
+		return attribute.Int(key, typed)
+	case int64:
+		return attribute.Int64(key, typed)
+	case float64:
+		return attribute.Float64(key, typed)
+	default:
+		return attribute.String(key, fmt.Sprint(value))
+	}
+}
@@ -0,0 +1,13 @@
+package shelfotel_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShelfotel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shelfotel Suite")
+}
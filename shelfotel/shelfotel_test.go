@@ -0,0 +1,176 @@
+package shelfotel_test
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelfotel"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ = Describe("Tracer", func() {
+	var (
+		exporter     *tracetest.InMemoryExporter
+		server       *httptest.Server
+		shelf        *shelflib.ShelfLib
+		artifactUri  string
+		lock         sync.Mutex
+		traceparents []string
+		statuses     []int
+	)
+
+	spanNamed := func(name string) tracetest.SpanStub {
+		for _, span := range exporter.GetSpans() {
+			if span.Name == name {
+				return span
+			}
+		}
+
+		Fail("No span named " + name)
+
+		return tracetest.SpanStub{}
+	}
+
+	attributeOf := func(span tracetest.SpanStub, key string) attribute.Value {
+		for _, attr := range span.Attributes {
+			if string(attr.Key) == key {
+				return attr.Value
+			}
+		}
+
+		return attribute.Value{}
+	}
+
+	eventsOf := func(span tracetest.SpanStub) []string {
+		var names []string
+
+		for _, event := range span.Events {
+			names = append(names, event.Name)
+		}
+
+		return names
+	}
+
+	BeforeEach(func() {
+		traceparents = nil
+		statuses = nil
+		exporter = tracetest.NewInMemoryExporter()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			traceparents = append(traceparents, request.Header.Get("traceparent"))
+			status := http.StatusOK
+
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(status)
+
+			if status != http.StatusOK {
+				writer.Write([]byte(`{"code": "resource_not_found", "message": "Not found"}`))
+			} else if strings.HasSuffix(request.URL.Path, "/_meta") {
+				writer.Write([]byte(`{"version": {"name": "version", "value": "1", "immutable": false}}`))
+			} else {
+				writer.Write([]byte(`{"name": "version", "value": "2", "immutable": false}`))
+			}
+		}))
+
+		artifactUri = server.URL + "/test/artifact/thing"
+		shelf = shelflib.New("VALIDTOKEN", log.New(ioutil.Discard, "", 0))
+		shelf.Request.Client = server.Client()
+		shelf.Request.Tracer = shelfotel.New(provider)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should create a request span inside the operation span", func() {
+		_, err := shelf.GetMetadata(artifactUri)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(exporter.GetSpans()).To(HaveLen(2))
+		operation := spanNamed("shelf.GetMetadata")
+		request := spanNamed("HTTP GET")
+		Expect(request.Parent.SpanID()).To(Equal(operation.SpanContext.SpanID()))
+		Expect(request.SpanContext.TraceID()).To(Equal(operation.SpanContext.TraceID()))
+		Expect(attributeOf(request, "http.status_code").AsInt64()).To(Equal(int64(200)))
+		Expect(attributeOf(request, "shelf.operation").AsString()).To(Equal("GetMetadata"))
+	})
+
+	It("should record the phases of the request as events", func() {
+		shelf.GetMetadata(artifactUri)
+
+		events := eventsOf(spanNamed("HTTP GET"))
+		Expect(events).To(ContainElement(shelflib.EventConnectStart))
+		Expect(events).To(ContainElement(shelflib.EventConnectDone))
+		Expect(events).To(ContainElement(shelflib.EventGotConn))
+		Expect(events).To(ContainElement(shelflib.EventFirstByte))
+	})
+
+	It("should send a traceparent header for the request span", func() {
+		shelf.GetMetadata(artifactUri)
+
+		request := spanNamed("HTTP GET")
+		Expect(traceparents).To(Equal([]string{
+			"00-" + request.SpanContext.TraceID().String() + "-" + request.SpanContext.SpanID().String() + "-01",
+		}))
+	})
+
+	It("should create a request span for every retry", func() {
+		statuses = []int{http.StatusServiceUnavailable}
+		shelf.Use(shelflib.Retry(&shelflib.Backoff{Attempts: 2, Initial: time.Millisecond, Max: time.Millisecond}))
+
+		_, err := shelf.GetMetadata(artifactUri)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		operation := spanNamed("shelf.GetMetadata")
+		var attempts []int64
+
+		for _, span := range exporter.GetSpans() {
+			if span.Name == "HTTP GET" {
+				Expect(span.Parent.SpanID()).To(Equal(operation.SpanContext.SpanID()))
+				attempts = append(attempts, attributeOf(span, "shelf.attempt").AsInt64())
+			}
+		}
+
+		Expect(attempts).To(Equal([]int64{0, 1}))
+		Expect(traceparents).To(HaveLen(2))
+		Expect(traceparents[0]).ShouldNot(Equal(traceparents[1]))
+	})
+
+	It("should record the error code on the operation span", func() {
+		statuses = []int{http.StatusNotFound}
+
+		_, err := shelf.GetMetadata(artifactUri)
+		Expect(err).Should(HaveOccurred())
+
+		operation := spanNamed("shelf.GetMetadata")
+		Expect(attributeOf(operation, "shelf.error_code").AsString()).To(Equal("resource_not_found"))
+	})
+
+	It("should nest the operations of a higher level operation", func() {
+		desired := map[string]*shelflib.MetadataProperty{"version": shelflib.CreateMetadataProperty("version", "2", false)}
+
+		_, err := shelf.ApplyMetadata(artifactUri, desired, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		apply := spanNamed("shelf.ApplyMetadata")
+		Expect(spanNamed("shelf.GetMetadata").Parent.SpanID()).To(Equal(apply.SpanContext.SpanID()))
+		Expect(spanNamed("shelf.UpdateMetadataProperty").Parent.SpanID()).To(Equal(apply.SpanContext.SpanID()))
+	})
+})
@@ -0,0 +1,86 @@
+// Package shelfprom reports shelflib metrics to Prometheus.
+package shelfprom
+
+import (
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Implements shelflib.Metrics with Prometheus collectors.
+type Metrics struct {
+	Requests  *prometheus.CounterVec
+	Errors    *prometheus.CounterVec
+	InFlight  *prometheus.GaugeVec
+	Latency   *prometheus.HistogramVec
+	Transfers *prometheus.HistogramVec
+}
+
+// Create Metrics and register its collectors with registerer.
+// Metric names are prefixed with namespace, which may be empty.
+func New(registerer prometheus.Registerer, namespace string) (*Metrics, error) {
+	metrics := &Metrics{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "shelf",
+			Name:      "requests_total",
+			Help:      "Requests sent to Shelf.",
+		}, []string{"operation"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "shelf",
+			Name:      "errors_total",
+			Help:      "Requests to Shelf that failed, by error code.",
+		}, []string{"operation", "code"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "shelf",
+			Name:      "in_flight_requests",
+			Help:      "Requests to Shelf waiting for a response.",
+		}, []string{"operation"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "shelf",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken by requests to Shelf.",
+			Buckets:   shelflib.LatencyBuckets,
+		}, []string{"operation"}),
+		Transfers: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "shelf",
+			Name:      "transfer_bytes",
+			Help:      "Size of artifacts uploaded to and downloaded from Shelf.",
+			Buckets:   shelflib.TransferBuckets,
+		}, []string{"operation", "direction"}),
+	}
+
+	collectors := []prometheus.Collector{metrics.Requests, metrics.Errors, metrics.InFlight, metrics.Latency, metrics.Transfers}
+
+	for _, collector := range collectors {
+		err := registerer.Register(collector)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+func (this *Metrics) RequestStarted(operation string) {
+	this.InFlight.WithLabelValues(operation).Inc()
+}
+
+func (this *Metrics) RequestDone(operation string, code string, duration time.Duration) {
+	this.InFlight.WithLabelValues(operation).Dec()
+	this.Requests.WithLabelValues(operation).Inc()
+	this.Latency.WithLabelValues(operation).Observe(duration.Seconds())
+
+	if code != "" {
+		this.Errors.WithLabelValues(operation, code).Inc()
+	}
+}
+
+func (this *Metrics) Transferred(operation string, direction string, bytes int64) {
+	this.Transfers.WithLabelValues(operation, direction).Observe(float64(bytes))
+}
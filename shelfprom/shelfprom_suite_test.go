@@ -0,0 +1,17 @@
+package shelfprom_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jarcoal/httpmock"
+	"testing"
+)
+
+func TestShelfprom(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shelfprom Suite")
+}
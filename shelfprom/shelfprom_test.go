@@ -0,0 +1,88 @@
+package shelfprom_test
+
+import (
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelfprom"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var artifactUri = "https://api.shelf.cwscloud.net/test/artifact/thing"
+
+var _ = Describe("Metrics", func() {
+	var (
+		registry *prometheus.Registry
+		metrics  *shelfprom.Metrics
+		shelf    *shelflib.ShelfLib
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		registry = prometheus.NewRegistry()
+		metrics, err = shelfprom.New(registry, "test")
+		Expect(err).ShouldNot(HaveOccurred())
+		shelf = shelflib.New("VALIDTOKEN", log.New(ioutil.Discard, "", 0))
+		shelf.Request.Metrics = metrics
+
+		httpmock.RegisterResponder("GET", artifactUri, httpmock.NewStringResponder(200, "Simple Text File"))
+		httpmock.RegisterResponder("POST", artifactUri, httpmock.NewStringResponder(201, ""))
+		httpmock.RegisterResponder("GET", artifactUri+"/_meta", func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(404, map[string]string{"message": "Not found", "code": "resource_not_found"})
+		})
+	})
+
+	It("should count requests and errors by operation", func() {
+		shelf.GetMetadata(artifactUri)
+		shelf.GetMetadata(artifactUri)
+		Expect(testutil.ToFloat64(metrics.Requests.WithLabelValues("GetMetadata"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.Errors.WithLabelValues("GetMetadata", "resource_not_found"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.InFlight.WithLabelValues("GetMetadata"))).To(Equal(0.0))
+	})
+
+	It("should observe latency and transfer size", func() {
+		body, err := shelf.DownloadArtifact(artifactUri)
+		Expect(err).ShouldNot(HaveOccurred())
+		ioutil.ReadAll(*body)
+		Expect(shelf.UploadArtifact(artifactUri, strings.NewReader("1234"))).ShouldNot(HaveOccurred())
+
+		Expect(testutil.CollectAndCount(metrics.Latency)).To(Equal(2))
+		expected := `
+# HELP test_shelf_transfer_bytes Size of artifacts uploaded to and downloaded from Shelf.
+# TYPE test_shelf_transfer_bytes histogram
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="1024"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="16384"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="262144"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="1.048576e+06"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="1.6777216e+07"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="2.68435456e+08"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="1.073741824e+09"} 1
+test_shelf_transfer_bytes_bucket{direction="download",operation="DownloadArtifact",le="+Inf"} 1
+test_shelf_transfer_bytes_sum{direction="download",operation="DownloadArtifact"} 16
+test_shelf_transfer_bytes_count{direction="download",operation="DownloadArtifact"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="1024"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="16384"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="262144"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="1.048576e+06"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="1.6777216e+07"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="2.68435456e+08"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="1.073741824e+09"} 1
+test_shelf_transfer_bytes_bucket{direction="upload",operation="UploadArtifact",le="+Inf"} 1
+test_shelf_transfer_bytes_sum{direction="upload",operation="UploadArtifact"} 4
+test_shelf_transfer_bytes_count{direction="upload",operation="UploadArtifact"} 1
+`
+		Expect(testutil.CollectAndCompare(metrics.Transfers, strings.NewReader(expected))).To(Succeed())
+	})
+
+	It("should fail to register twice", func() {
+		_, err := shelfprom.New(registry, "test")
+		Expect(err).Should(HaveOccurred())
+	})
+})
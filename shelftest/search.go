@@ -0,0 +1,256 @@
+package shelftest
+
+import (
+	"encoding/json"
+	"github.com/not-nexus/shelf-lib-go"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Body of a search request. Field names match both shelflib's
+// SearchCriteria and the lower case names Shelf documents.
+type searchBody struct {
+	Search interface{}
+	Sort   interface{}
+	Limit  int
+}
+
+// A single criterion such as "version>=1.2, VERSION".
+type criterion struct {
+	name     string
+	operator string
+	value    string
+	version  bool
+}
+
+// A single sort key such as "version, DESC, VERSION".
+type sortKey struct {
+	name       string
+	descending bool
+	version    bool
+}
+
+var criterionPattern = regexp.MustCompile(`^\s*([^=~!<>\s]+)\s*(~=|!=|>=|<=|=|>|<)\s*(.*?)\s*$`)
+
+// Searches the artifacts inside a directory. Matches are returned
+// as Link headers, sorted by path unless the search says otherwise.
+func (this *Server) serveSearch(writer http.ResponseWriter, request *http.Request, bucket string, directory string) {
+	var body searchBody
+
+	if request.Method != "POST" {
+		writeError(writer, "Method not allowed", shelflib.CodeMethodNotAllowed)
+
+		return
+	}
+
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(writer, "Invalid search body", shelflib.CodeInvalidRequestDataFormat)
+
+		return
+	}
+
+	criteria, ok := parseCriteria(toStrings(body.Search))
+	sortKeys := parseSort(toStrings(body.Sort))
+
+	if !ok || body.Limit < 0 {
+		writeError(writer, "Invalid search criteria", shelflib.CodeInvalidSearchCriteria)
+
+		return
+	}
+
+	prefix := artifactKey(bucket, directory) + "/"
+	matches := make([]string, 0)
+
+	for key, stored := range this.artifacts {
+		if strings.HasPrefix(key, prefix) && matchesAll(stored.metadata, criteria) {
+			matches = append(matches, key)
+		}
+	}
+
+	sort.Slice(matches, func(i int, j int) bool {
+		for _, key := range sortKeys {
+			left := this.artifacts[matches[i]].metadata[key.name]
+			right := this.artifacts[matches[j]].metadata[key.name]
+			result := compareProperties(left, right, key.version)
+
+			if result != 0 {
+				return (result < 0) != key.descending
+			}
+		}
+
+		return matches[i] < matches[j]
+	})
+
+	if body.Limit > 0 && len(matches) > body.Limit {
+		matches = matches[:body.Limit]
+	}
+
+	for _, key := range matches {
+		writer.Header().Add("Link", formatLink("/"+key, "item", "artifact"))
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Search and sort may be a single string or a list of them.
+func toStrings(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}
+	case []interface{}:
+		strs := make([]string, 0, len(typed))
+
+		for _, item := range typed {
+			if str, ok := item.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+
+		return strs
+	default:
+		return nil
+	}
+}
+
+func parseCriteria(search []string) ([]*criterion, bool) {
+	criteria := make([]*criterion, 0, len(search))
+
+	for _, raw := range search {
+		version := false
+
+		if trimmed := strings.TrimSuffix(raw, ", VERSION"); trimmed != raw {
+			raw = trimmed
+			version = true
+		}
+
+		match := criterionPattern.FindStringSubmatch(raw)
+
+		if match == nil {
+			return nil, false
+		}
+
+		criteria = append(criteria, &criterion{name: match[1], operator: match[2], value: match[3], version: version})
+	}
+
+	return criteria, true
+}
+
+func parseSort(keys []string) []*sortKey {
+	parsed := make([]*sortKey, 0, len(keys))
+
+	for _, raw := range keys {
+		parts := strings.Split(raw, ",")
+		key := &sortKey{name: strings.TrimSpace(parts[0])}
+
+		for _, part := range parts[1:] {
+			switch strings.ToUpper(strings.TrimSpace(part)) {
+			case "DESC":
+				key.descending = true
+			case "VERSION":
+				key.version = true
+			}
+		}
+
+		parsed = append(parsed, key)
+	}
+
+	return parsed
+}
+
+func matchesAll(metadata map[string]*shelflib.MetadataProperty, criteria []*criterion) bool {
+	for _, current := range criteria {
+		prop, ok := metadata[current.name]
+
+		if !ok || !current.matches(prop.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (this *criterion) matches(value string) bool {
+	switch this.operator {
+	case "=":
+		return wildcardMatch(this.value, value)
+	case "!=":
+		return !wildcardMatch(this.value, value)
+	case "~=":
+		return strings.Contains(value, this.value)
+	}
+
+	result := compareValues(value, this.value, this.version)
+
+	switch this.operator {
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	default:
+		return result < 0
+	}
+}
+
+// Matches value against a pattern where * matches anything
+// and \* matches a literal star.
+func wildcardMatch(pattern string, value string) bool {
+	parts := strings.Split(strings.ReplaceAll(pattern, `\*`, "\x00"), "*")
+
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(strings.ReplaceAll(part, "\x00", "*"))
+	}
+
+	matched, _ := regexp.MatchString("^"+strings.Join(parts, ".*")+"$", value)
+
+	return matched
+}
+
+// Missing properties sort last.
+func compareProperties(left *shelflib.MetadataProperty, right *shelflib.MetadataProperty, version bool) int {
+	switch {
+	case left == nil && right == nil:
+		return 0
+	case left == nil:
+		return 1
+	case right == nil:
+		return -1
+	}
+
+	return compareValues(left.Value, right.Value, version)
+}
+
+// Compares values as strings, or as versions whose
+// dot separated parts are compared numerically when
+// both are numbers.
+func compareValues(left string, right string, version bool) int {
+	if !version {
+		return strings.Compare(left, right)
+	}
+
+	leftParts := strings.Split(left, ".")
+	rightParts := strings.Split(right, ".")
+
+	for i := 0; i < len(leftParts) && i < len(rightParts); i++ {
+		leftNumber, leftErr := strconv.Atoi(leftParts[i])
+		rightNumber, rightErr := strconv.Atoi(rightParts[i])
+
+		if leftErr == nil && rightErr == nil {
+			if leftNumber != rightNumber {
+				if leftNumber < rightNumber {
+					return -1
+				}
+
+				return 1
+			}
+		} else if result := strings.Compare(leftParts[i], rightParts[i]); result != 0 {
+			return result
+		}
+	}
+
+	return len(leftParts) - len(rightParts)
+}
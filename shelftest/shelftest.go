@@ -0,0 +1,538 @@
+// Package shelftest provides an in-memory Shelf server for tests that
+// exercise ShelfLib end to end.
+package shelftest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/not-nexus/shelf-lib-go"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata properties Shelf sets on every uploaded artifact.
+// They are all immutable.
+const (
+	PropertyArtifactName = shelflib.PropertyArtifactName
+	PropertyArtifactPath = shelflib.PropertyArtifactPath
+	PropertyMd5Hash      = shelflib.PropertyMd5Hash
+	PropertySha256Hash   = shelflib.PropertySha256Hash
+	PropertyCreatedDate  = shelflib.PropertyCreatedDate
+)
+
+// Shelf API backed by memory. Artifacts are keyed by bucket and
+// path. Requests must carry one of the server's tokens in the
+// Authorization header, or any token if it has none.
+type Server struct {
+	*httptest.Server
+	// Time artifacts are created at. Defaults to time.Now.
+	Now       func() time.Time
+	lock      sync.Mutex
+	tokens    map[string]bool
+	artifacts map[string]*artifact
+	requests  []string
+}
+
+type artifact struct {
+	content  []byte
+	metadata map[string]*shelflib.MetadataProperty
+	// Bumped on every change to a property. Sent as its ETag.
+	revisions map[string]int
+}
+
+// Body of a metadata property request or response.
+type property struct {
+	Name      string `json:"name,omitempty"`
+	Value     string `json:"value"`
+	Immutable bool   `json:"immutable"`
+}
+
+// Start a Server that accepts the given tokens.
+// Close it when done.
+func NewServer(tokens ...string) *Server {
+	server := &Server{
+		Now:       time.Now,
+		tokens:    make(map[string]bool),
+		artifacts: make(map[string]*artifact),
+	}
+
+	for _, token := range tokens {
+		server.tokens[token] = true
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+
+	return server
+}
+
+// Create a ShelfLib that sends requests to the server with token.
+func (this *Server) NewShelf(token string) *shelflib.ShelfLib {
+	shelf := shelflib.New(token, log.New(ioutil.Discard, "", 0))
+	shelf.Request.Client = this.Client()
+
+	return shelf
+}
+
+// URL of an artifact, or of a directory of artifacts.
+func (this *Server) ArtifactUrl(bucket string, artifactPath string) string {
+	return this.URL + "/" + bucket + "/artifact/" + strings.TrimPrefix(artifactPath, "/")
+}
+
+// Store an artifact as if it was uploaded, replacing any
+// existing artifact at the same path.
+func (this *Server) PutArtifact(bucket string, artifactPath string, content []byte) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.artifacts[artifactKey(bucket, artifactPath)] = this.newArtifact(bucket, artifactPath, content)
+}
+
+// Set a metadata property of an artifact, ignoring immutability.
+// Returns false if there is no such artifact.
+func (this *Server) SetMetadata(bucket string, artifactPath string, prop *shelflib.MetadataProperty) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	stored, ok := this.artifacts[artifactKey(bucket, artifactPath)]
+
+	if ok {
+		stored.set(prop)
+	}
+
+	return ok
+}
+
+// Content and a copy of the metadata of an artifact.
+func (this *Server) Artifact(bucket string, artifactPath string) ([]byte, map[string]*shelflib.MetadataProperty, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	stored, ok := this.artifacts[artifactKey(bucket, artifactPath)]
+
+	if !ok {
+		return nil, nil, false
+	}
+
+	return stored.content, stored.copyMetadata(), true
+}
+
+// Requests received so far, such as "GET /bucket/artifact/a/_meta".
+func (this *Server) Requests() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return append([]string{}, this.requests...)
+}
+
+// Forget the requests received so far.
+func (this *Server) ResetRequests() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.requests = nil
+}
+
+func (this *Server) serve(writer http.ResponseWriter, request *http.Request) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.requests = append(this.requests, request.Method+" "+request.URL.Path)
+	token := request.Header.Get("Authorization")
+
+	if token == "" || (len(this.tokens) > 0 && !this.tokens[token]) {
+		writeError(writer, "Permission denied", shelflib.CodePermissionDenied)
+
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 3)
+
+	if len(parts) < 2 || parts[1] != "artifact" {
+		writeError(writer, "Resource not found", shelflib.CodeResourceNotFound)
+
+		return
+	}
+
+	bucket := parts[0]
+	artifactPath := ""
+
+	if len(parts) == 3 {
+		artifactPath = parts[2]
+	}
+
+	segments := strings.Split(artifactPath, "/")
+
+	for i, segment := range segments {
+		switch segment {
+		case "_search":
+			this.serveSearch(writer, request, bucket, strings.Join(segments[:i], "/"))
+
+			return
+		case "_meta":
+			this.serveMetadata(writer, request, bucket, strings.Join(segments[:i], "/"), strings.Join(segments[i+1:], "/"))
+
+			return
+		}
+	}
+
+	this.serveArtifact(writer, request, bucket, artifactPath)
+}
+
+func (this *Server) serveArtifact(writer http.ResponseWriter, request *http.Request, bucket string, artifactPath string) {
+	key := artifactKey(bucket, artifactPath)
+	stored, ok := this.artifacts[key]
+
+	switch request.Method {
+	case "GET", "HEAD":
+		if ok {
+			link := "/" + key
+			writer.Header().Add("Link", formatLink(link, "self", "artifact"))
+			writer.Header().Add("Link", formatLink(link+"/_meta", "related", "metadata"))
+
+			if request.Method == "HEAD" {
+				writer.WriteHeader(http.StatusNoContent)
+			} else {
+				writer.Header().Set("Content-Type", "application/octet-stream")
+				writer.Write(stored.content)
+			}
+
+			return
+		}
+
+		children := this.children(bucket, artifactPath)
+
+		if len(children) == 0 && strings.Trim(artifactPath, "/") != "" {
+			writeError(writer, "Resource not found", shelflib.CodeResourceNotFound)
+
+			return
+		}
+
+		for _, child := range children {
+			writer.Header().Add("Link", child)
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	case "POST":
+		if artifactPath == "" || strings.HasSuffix(artifactPath, "/") || strings.HasPrefix(path.Base(artifactPath), "_") {
+			writeError(writer, "Invalid artifact name", shelflib.CodeInvalidArtifactName)
+
+			return
+		}
+
+		if ok || len(this.children(bucket, artifactPath)) > 0 {
+			writeError(writer, "Cannot upload over an existing artifact or directory", shelflib.CodeDuplicateArtifact)
+
+			return
+		}
+
+		file, _, err := request.FormFile("file")
+
+		if err != nil {
+			writeError(writer, "Upload must be a multipart form with a file", shelflib.CodeInvalidRequestDataFormat)
+
+			return
+		}
+
+		defer file.Close()
+		content, err := ioutil.ReadAll(file)
+
+		if err != nil {
+			writeError(writer, err.Error(), shelflib.CodeInvalidRequestDataFormat)
+
+			return
+		}
+
+		this.artifacts[key] = this.newArtifact(bucket, artifactPath, content)
+		writer.Header().Set("Location", "/"+key)
+		writer.WriteHeader(http.StatusCreated)
+	default:
+		writeError(writer, "Method not allowed", shelflib.CodeMethodNotAllowed)
+	}
+}
+
+func (this *Server) serveMetadata(writer http.ResponseWriter, request *http.Request, bucket string, artifactPath string, name string) {
+	stored, ok := this.artifacts[artifactKey(bucket, artifactPath)]
+
+	if !ok {
+		writeError(writer, "Resource not found", shelflib.CodeResourceNotFound)
+
+		return
+	}
+
+	if name == "" {
+		this.serveBulkMetadata(writer, request, stored)
+
+		return
+	}
+
+	existing, exists := stored.metadata[name]
+
+	switch request.Method {
+	case "GET":
+		if !exists {
+			writeError(writer, "Metadata property "+name+" does not exist", shelflib.CodeResourceNotFound)
+
+			return
+		}
+
+		writer.Header().Set("ETag", stored.etag(name))
+		writeJson(writer, http.StatusOK, toProperty(existing))
+	case "PUT", "POST":
+		data, err := ioutil.ReadAll(request.Body)
+
+		if err != nil {
+			writeError(writer, err.Error(), shelflib.CodeInvalidRequestDataFormat)
+
+			return
+		}
+
+		body, err := decodeProperty(data)
+
+		if err != nil {
+			writeError(writer, "Invalid metadata property: "+err.Error(), shelflib.CodeInvalidRequestDataFormat)
+
+			return
+		}
+
+		if exists && existing.Immutable {
+			writeError(writer, "Metadata property "+name+" is immutable", shelflib.CodeForbiddenImmutableProperty)
+
+			return
+		}
+
+		if exists && request.Method == "POST" {
+			writeError(writer, "Metadata property "+name+" already exists", shelflib.CodeForbidden)
+
+			return
+		}
+
+		if ifMatch := request.Header.Get("If-Match"); ifMatch != "" && ifMatch != stored.etag(name) {
+			writeError(writer, "Metadata property "+name+" has changed", shelflib.CodePreconditionFailed)
+
+			return
+		}
+
+		prop := shelflib.CreateMetadataProperty(name, body.Value, body.Immutable)
+		stored.set(prop)
+		writer.Header().Set("ETag", stored.etag(name))
+		status := http.StatusOK
+
+		if !exists {
+			status = http.StatusCreated
+		}
+
+		writeJson(writer, status, toProperty(prop))
+	case "DELETE":
+		if !exists {
+			writeError(writer, "Metadata property "+name+" does not exist", shelflib.CodeResourceNotFound)
+
+			return
+		}
+
+		if existing.Immutable {
+			writeError(writer, "Metadata property "+name+" is immutable", shelflib.CodeForbiddenImmutableProperty)
+
+			return
+		}
+
+		delete(stored.metadata, name)
+		stored.revisions[name]++
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(writer, "Method not allowed", shelflib.CodeMethodNotAllowed)
+	}
+}
+
+// Bulk metadata requests. A PUT changes the properties given and
+// fails without changing any if one of them is immutable.
+func (this *Server) serveBulkMetadata(writer http.ResponseWriter, request *http.Request, stored *artifact) {
+	switch request.Method {
+	case "GET":
+		writeJson(writer, http.StatusOK, stored.bulk())
+	case "PUT":
+		var raw map[string]json.RawMessage
+
+		if err := json.NewDecoder(request.Body).Decode(&raw); err != nil {
+			writeError(writer, "Invalid metadata", shelflib.CodeInvalidRequestDataFormat)
+
+			return
+		}
+
+		body := make(map[string]*property)
+
+		for name, data := range raw {
+			prop, err := decodeProperty(data)
+
+			if err != nil {
+				writeError(writer, "Invalid metadata property "+name+": "+err.Error(), shelflib.CodeInvalidRequestDataFormat)
+
+				return
+			}
+
+			body[name] = prop
+		}
+
+		for name, prop := range body {
+			existing, exists := stored.metadata[name]
+
+			if exists && existing.Immutable && (existing.Value != prop.Value || !prop.Immutable) {
+				writeError(writer, "Metadata property "+name+" is immutable", shelflib.CodeForbiddenImmutableProperty)
+
+				return
+			}
+		}
+
+		for name, prop := range body {
+			if existing, exists := stored.metadata[name]; !exists || !existing.Immutable {
+				stored.set(shelflib.CreateMetadataProperty(name, prop.Value, prop.Immutable))
+			}
+		}
+
+		writeJson(writer, http.StatusCreated, stored.bulk())
+	default:
+		writeError(writer, "Method not allowed", shelflib.CodeMethodNotAllowed)
+	}
+}
+
+// Links to the artifacts and directories directly inside a directory.
+func (this *Server) children(bucket string, directory string) []string {
+	prefix := artifactKey(bucket, directory) + "/"
+	seen := make(map[string]bool)
+	links := make([]string, 0)
+
+	for key := range this.artifacts {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+
+		if strings.Contains(strings.TrimPrefix(key, prefix), "/") {
+			if !seen[name+"/"] {
+				seen[name+"/"] = true
+				links = append(links, formatLink("/"+prefix+name+"/", "item", "directory"))
+			}
+		} else {
+			links = append(links, formatLink("/"+prefix+name, "item", "artifact"))
+		}
+	}
+
+	sort.Strings(links)
+
+	return links
+}
+
+// Creates an artifact with the metadata Shelf sets on upload.
+func (this *Server) newArtifact(bucket string, artifactPath string, content []byte) *artifact {
+	md5Sum := md5.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	created := &artifact{
+		content:   append([]byte{}, content...),
+		metadata:  make(map[string]*shelflib.MetadataProperty),
+		revisions: make(map[string]int),
+	}
+
+	created.set(shelflib.CreateMetadataProperty(PropertyArtifactName, path.Base(artifactPath), true))
+	created.set(shelflib.CreateMetadataProperty(PropertyArtifactPath, "/"+strings.Trim(artifactPath, "/"), true))
+	created.set(shelflib.CreateMetadataProperty(PropertyMd5Hash, hex.EncodeToString(md5Sum[:]), true))
+	created.set(shelflib.CreateMetadataProperty(PropertySha256Hash, hex.EncodeToString(sha256Sum[:]), true))
+	created.set(shelflib.CreateMetadataProperty(PropertyCreatedDate, this.Now().UTC().Format(time.RFC3339), true))
+
+	return created
+}
+
+func (this *artifact) set(prop *shelflib.MetadataProperty) {
+	this.metadata[prop.Name] = shelflib.CreateMetadataProperty(prop.Name, prop.Value, prop.Immutable)
+	this.revisions[prop.Name]++
+}
+
+func (this *artifact) etag(name string) string {
+	return `"` + strconv.Itoa(this.revisions[name]) + `"`
+}
+
+func (this *artifact) bulk() map[string]*property {
+	bulk := make(map[string]*property)
+
+	for name, prop := range this.metadata {
+		bulk[name] = &property{Value: prop.Value, Immutable: prop.Immutable}
+	}
+
+	return bulk
+}
+
+func (this *artifact) copyMetadata() map[string]*shelflib.MetadataProperty {
+	copied := make(map[string]*shelflib.MetadataProperty)
+
+	for name, prop := range this.metadata {
+		copied[name] = shelflib.CreateMetadataProperty(prop.Name, prop.Value, prop.Immutable)
+	}
+
+	return copied
+}
+
+// Decodes a metadata property as strictly as Shelf does. Field
+// names must be lowercase and the value must be given.
+func decodeProperty(data []byte) (*property, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		return nil, errors.New("property is null")
+	}
+
+	for field := range fields {
+		switch field {
+		case "name", "value", "immutable":
+		default:
+			return nil, errors.New("unknown field " + field)
+		}
+	}
+
+	if _, ok := fields["value"]; !ok {
+		return nil, errors.New("value is missing")
+	}
+
+	var prop property
+
+	return &prop, json.Unmarshal(data, &prop)
+}
+
+func toProperty(prop *shelflib.MetadataProperty) *property {
+	return &property{Name: prop.Name, Value: prop.Value, Immutable: prop.Immutable}
+}
+
+// Key artifacts are stored under, which is also the path of
+// their URL: "<bucket>/artifact/<path>".
+func artifactKey(bucket string, artifactPath string) string {
+	return strings.TrimSuffix(bucket+"/artifact/"+strings.Trim(artifactPath, "/"), "/")
+}
+
+func formatLink(url string, rel string, title string) string {
+	return "<" + url + `>; rel="` + rel + `"; title="` + title + `"`
+}
+
+func writeJson(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
+
+// Writes an error response the way Shelf does, with the
+// status that goes with code.
+func writeError(writer http.ResponseWriter, message string, code string) {
+	writeJson(writer, shelflib.StatusForCode(code), map[string]string{"message": message, "code": code})
+}
@@ -0,0 +1,13 @@
+package shelftest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShelftest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shelftest Suite")
+}
@@ -0,0 +1,232 @@
+package shelftest_test
+
+import (
+	"errors"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tomnomnom/linkheader"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		server *shelftest.Server
+		shelf  *shelflib.ShelfLib
+	)
+
+	urls := func(links *linkheader.Links) []string {
+		found := make([]string, 0)
+
+		for _, link := range *links {
+			found = append(found, link.URL)
+		}
+
+		return found
+	}
+
+	BeforeEach(func() {
+		server = shelftest.NewServer("VALIDTOKEN")
+		server.Now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+		shelf = server.NewShelf("VALIDTOKEN")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("artifacts", func() {
+		It("should upload and download artifacts", func() {
+			Expect(shelf.UploadArtifact(server.ArtifactUrl("test", "a/thing"), strings.NewReader("contents"))).To(BeNil())
+
+			body, err := shelf.DownloadArtifact(server.ArtifactUrl("test", "a/thing"))
+			Expect(err).ShouldNot(HaveOccurred())
+			contents, _ := ioutil.ReadAll(*body)
+			Expect(string(contents)).To(Equal("contents"))
+		})
+
+		It("should reject uploading over an existing artifact", func() {
+			server.PutArtifact("test", "thing", []byte("first"))
+
+			err := shelf.UploadArtifact(server.ArtifactUrl("test", "thing"), strings.NewReader("second"))
+			Expect(shelflib.IsDuplicate(err)).To(BeTrue())
+			content, _, _ := server.Artifact("test", "thing")
+			Expect(string(content)).To(Equal("first"))
+		})
+
+		It("should link an artifact to its metadata", func() {
+			server.PutArtifact("test", "thing", []byte("contents"))
+
+			links, err := shelf.ListArtifact(server.ArtifactUrl("test", "thing"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*links).To(Equal(linkheader.Parse(`</test/artifact/thing>; rel="self"; title="artifact"`)))
+		})
+
+		It("should list the contents of a directory", func() {
+			server.PutArtifact("test", "dir/a", []byte("a"))
+			server.PutArtifact("test", "dir/sub/b", []byte("b"))
+
+			links, err := shelf.ListArtifact(server.ArtifactUrl("test", "dir/"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(urls(links)).To(Equal([]string{"/test/artifact/dir/a", "/test/artifact/dir/sub/"}))
+			Expect((*links)[1].Params["title"]).To(Equal("directory"))
+		})
+
+		It("should return not found for missing artifacts", func() {
+			_, err := shelf.DownloadArtifact(server.ArtifactUrl("test", "missing"))
+			Expect(shelflib.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should reject unknown tokens", func() {
+			server.PutArtifact("test", "thing", []byte("contents"))
+			shelf = server.NewShelf("INVALID")
+
+			_, err := shelf.DownloadArtifact(server.ArtifactUrl("test", "thing"))
+			Expect(shelflib.IsPermissionDenied(err)).To(BeTrue())
+		})
+	})
+
+	Context("metadata", func() {
+		artifactUrl := func() string {
+			return server.ArtifactUrl("test", "dir/thing")
+		}
+
+		BeforeEach(func() {
+			server.PutArtifact("test", "dir/thing", []byte("contents"))
+		})
+
+		It("should set hashes and other immutable properties on upload", func() {
+			metadata, err := shelf.GetMetadata(artifactUrl())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(metadata).To(Equal(map[string]*shelflib.MetadataProperty{
+				"artifactName": shelflib.CreateMetadataProperty("artifactName", "thing", true),
+				"artifactPath": shelflib.CreateMetadataProperty("artifactPath", "/dir/thing", true),
+				"md5Hash":      shelflib.CreateMetadataProperty("md5Hash", "98bf7d8c15784f0a3d63204441e1e2aa", true),
+				"sha256Hash":   shelflib.CreateMetadataProperty("sha256Hash", "d1b2a59fbea7e20077af9f91b27e95e865061b270be03ff539ab3b73587882e8", true),
+				"createdDate":  shelflib.CreateMetadataProperty("createdDate", "2020-01-02T03:04:05Z", true),
+			}))
+		})
+
+		It("should create, update and delete properties", func() {
+			_, err := shelf.CreateMetadataProperty(artifactUrl(), shelflib.CreateMetadataProperty("version", "1", false))
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = shelf.UpdateMetadataProperty(artifactUrl(), shelflib.CreateMetadataProperty("version", "2", false))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			prop, err := shelf.GetMetadataProperty(artifactUrl(), "version")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(prop.Value).To(Equal("2"))
+
+			Expect(shelf.DeleteMetadataProperty(artifactUrl(), "version")).To(BeNil())
+			_, err = shelf.GetMetadataProperty(artifactUrl(), "version")
+			Expect(shelflib.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should not create a property that exists", func() {
+			server.SetMetadata("test", "dir/thing", shelflib.CreateMetadataProperty("version", "1", false))
+
+			_, err := shelf.CreateMetadataProperty(artifactUrl(), shelflib.CreateMetadataProperty("version", "2", false))
+			Expect(shelflib.HasCode(err, shelflib.CodeForbidden)).To(BeTrue())
+		})
+
+		It("should protect immutable properties", func() {
+			_, err := shelf.UpdateMetadataProperty(artifactUrl(), shelflib.CreateMetadataProperty("md5Hash", "abc", false))
+			Expect(shelflib.IsImmutable(err)).To(BeTrue())
+			Expect(shelflib.IsImmutable(shelf.DeleteMetadataProperty(artifactUrl(), "md5Hash"))).To(BeTrue())
+
+			_, err = shelf.UpdateMetadata(artifactUrl(), map[string]*shelflib.MetadataProperty{
+				"version":      shelflib.CreateMetadataProperty("version", "1", false),
+				"artifactName": shelflib.CreateMetadataProperty("artifactName", "other", true),
+			})
+			Expect(shelflib.IsImmutable(err)).To(BeTrue())
+			_, metadata, _ := server.Artifact("test", "dir/thing")
+			Expect(metadata).ShouldNot(HaveKey("version"))
+		})
+
+		It("should update properties in bulk", func() {
+			metadata, err := shelf.UpdateMetadata(artifactUrl(), map[string]*shelflib.MetadataProperty{
+				"version": shelflib.CreateMetadataProperty("version", "1", false),
+				"build":   shelflib.CreateMetadataProperty("build", "7", true),
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(metadata["version"].Value).To(Equal("1"))
+			Expect(metadata["build"].Immutable).To(BeTrue())
+			Expect(metadata).To(HaveKey("md5Hash"))
+		})
+
+		It("should reject metadata Shelf would not accept", func() {
+			put := func(path string, body string) int {
+				request, _ := http.NewRequest("PUT", artifactUrl()+path, strings.NewReader(body))
+				request.Header.Set("Authorization", "VALIDTOKEN")
+				response, err := http.DefaultClient.Do(request)
+				Expect(err).ShouldNot(HaveOccurred())
+				response.Body.Close()
+
+				return response.StatusCode
+			}
+
+			Expect(put("/_meta/version", `{"Value": "1"}`)).To(Equal(http.StatusBadRequest))
+			Expect(put("/_meta/version", `null`)).To(Equal(http.StatusBadRequest))
+			Expect(put("/_meta", `{"version": {"Value": "1"}}`)).To(Equal(http.StatusBadRequest))
+			Expect(put("/_meta", `{"version": null}`)).To(Equal(http.StatusBadRequest))
+			Expect(put("/_meta", `{"version": {"value": "1", "immutable": false}}`)).To(Equal(http.StatusCreated))
+		})
+
+		It("should support conditional updates", func() {
+			server.SetMetadata("test", "dir/thing", shelflib.CreateMetadataProperty("status", "pending", false))
+
+			prop, err := shelf.UpdateMetadataPropertyIf(artifactUrl(), "status", "pending", "released")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(prop.Value).To(Equal("released"))
+
+			_, err = shelf.UpdateMetadataPropertyIf(artifactUrl(), "status", "pending", "released")
+			Expect(errors.Is(err, shelflib.ErrConflict)).To(BeTrue())
+		})
+	})
+
+	Context("search", func() {
+		BeforeEach(func() {
+			for i, version := range []string{"1.2", "1.10", "2.0"} {
+				artifactPath := "builds/" + string(rune('a'+i))
+				server.PutArtifact("test", artifactPath, []byte(version))
+				server.SetMetadata("test", artifactPath, shelflib.CreateMetadataProperty("version", version, false))
+			}
+
+			server.PutArtifact("test", "other/z", []byte("z"))
+		})
+
+		It("should find artifacts in a directory matching the criteria", func() {
+			links, err := shelf.Search(server.ArtifactUrl("test", "builds"), &shelflib.SearchCriteria{Search: []string{"version=1.*"}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(urls(links)).To(Equal([]string{"/test/artifact/builds/a", "/test/artifact/builds/b"}))
+		})
+
+		It("should compare and sort versions", func() {
+			links, err := shelf.Search(server.ArtifactUrl("test", ""), &shelflib.SearchCriteria{
+				Search: []string{"version>=1.5, VERSION"},
+				Sort:   []string{"version, DESC, VERSION"},
+				Limit:  1,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(urls(links)).To(Equal([]string{"/test/artifact/builds/c"}))
+		})
+
+		It("should reject invalid criteria", func() {
+			_, err := shelf.Search(server.ArtifactUrl("test", ""), &shelflib.SearchCriteria{Search: []string{"version"}})
+			Expect(shelflib.HasCode(err, shelflib.CodeInvalidSearchCriteria)).To(BeTrue())
+		})
+	})
+
+	It("should record requests", func() {
+		server.PutArtifact("test", "thing", []byte("contents"))
+		shelf.GetMetadata(server.ArtifactUrl("test", "thing"))
+
+		Expect(server.Requests()).To(Equal([]string{"GET /test/artifact/thing/_meta"}))
+		server.ResetRequests()
+		Expect(server.Requests()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,212 @@
+package shelflib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+type SyncAction string
+
+const (
+	// The file is not in Shelf yet and is uploaded.
+	SyncUpload SyncAction = "upload"
+	// The artifact has the same sha256 as the file.
+	SyncUnchanged SyncAction = "unchanged"
+	// The artifact has different content. Shelf cannot overwrite
+	// artifacts, so it is reported as a failure.
+	SyncChanged SyncAction = "changed"
+)
+
+// What Sync does with a local file.
+type SyncEntry struct {
+	// Path relative to the directory and prefix.
+	Path     string
+	Action   SyncAction
+	FilePath string
+	// Hex encoded sha256 of the file and of the artifact. Only
+	// set when there is an artifact to compare with.
+	LocalHash  string
+	RemoteHash string
+}
+
+// Options for Sync.
+type SyncOptions struct {
+	// Print the plan instead of making changes.
+	DryRun bool
+	// Where the plan is printed on a dry run. Defaults to os.Stdout.
+	Output io.Writer
+	// Files compared and uploaded at once. Defaults to DefaultConcurrency.
+	Concurrency int
+	// Only files matching one of these globs are synced, if any are given.
+	Include []string
+	// Files and directories matching one of these globs are left out.
+	Exclude  []string
+	Symlinks SymlinkPolicy
+	// Returns metadata to set on an artifact once it is uploaded.
+	Metadata func(relativePath string, filePath string) map[string]*MetadataProperty
+}
+
+// Result of Sync. The embedded TransferReport has the files that were
+// uploaded or left out, and those that failed, including changed files.
+type SyncReport struct {
+	DryRun bool
+	// Every file that was synced, or would have been on a dry run, sorted by path.
+	Plan []*SyncEntry
+	// Artifacts under the prefix with no local file.
+	RemoteOnly []string
+	*TransferReport
+}
+
+// Formats the entry as a line of a plan.
+func (this *SyncEntry) String() string {
+	if this.Action == SyncChanged {
+		return fmt.Sprintf("changed %s (local sha256 %s, remote %s)", this.Path, this.LocalHash, this.RemoteHash)
+	}
+
+	return string(this.Action) + " " + this.Path
+}
+
+// Uploads the files under localDir that are not under remotePrefix yet,
+// like UploadDirectory. Files that are already there are compared by
+// their sha256Hash metadata: unchanged files are left alone, changed
+// ones are failures because Shelf cannot overwrite artifacts.
+func (this *ShelfLib) Sync(localDir string, remotePrefix string, opts *SyncOptions) (*SyncReport, *ShelfError) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	shelfLib, end := this.operation("Sync")
+	defer end()
+
+	report := &SyncReport{DryRun: opts.DryRun, Plan: make([]*SyncEntry, 0), RemoteOnly: make([]string, 0), TransferReport: newTransferReport()}
+	files, shelfErr := listLocal(localDir, opts.Include, opts.Exclude, opts.Symlinks, report.TransferReport)
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	remote, shelfErr := shelfLib.listRemote(remotePrefix)
+
+	if shelfErr != nil {
+		return report, shelfErr
+	}
+
+	for _, relativePath := range sortedKeys(remote) {
+		if _, ok := files[relativePath]; !ok {
+			report.RemoteOnly = append(report.RemoteOnly, relativePath)
+		}
+	}
+
+	lock := sync.Mutex{}
+
+	forEachConcurrently(sortedKeys(files), opts.Concurrency, func(relativePath string) {
+		entry, shelfErr := shelfLib.syncEntry(relativePath, files[relativePath], remote[relativePath])
+
+		if shelfErr != nil {
+			report.failed(relativePath, shelfErr)
+
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		report.Plan = append(report.Plan, entry)
+	})
+
+	sort.Slice(report.Plan, func(i int, j int) bool {
+		return report.Plan[i].Path < report.Plan[j].Path
+	})
+
+	if opts.DryRun {
+		output := opts.Output
+
+		if output == nil {
+			output = os.Stdout
+		}
+
+		for _, entry := range report.Plan {
+			fmt.Fprintln(output, entry)
+		}
+
+		return report, nil
+	}
+
+	uploads := make([]string, 0)
+
+	for _, entry := range report.Plan {
+		switch entry.Action {
+		case SyncUpload:
+			uploads = append(uploads, entry.Path)
+		case SyncUnchanged:
+			report.skipped(entry.Path, "unchanged")
+		case SyncChanged:
+			report.failed(entry.Path, CreateShelfError("Content of "+entry.Path+" changed, but Shelf cannot overwrite artifacts.", CodeDuplicateArtifact))
+		}
+	}
+
+	forEachConcurrently(uploads, opts.Concurrency, func(relativePath string) {
+		shelfLib.uploadFile(files[relativePath], remotePrefix, relativePath, false, opts.Metadata, report.TransferReport)
+	})
+
+	report.sort()
+
+	return report, nil
+}
+
+// URLs of the artifacts under prefix, keyed by relative path.
+// A prefix that does not exist yet has no artifacts.
+func (this *ShelfLib) listRemote(prefix string) (map[string]string, *ShelfError) {
+	artifacts := make(map[string]string)
+
+	shelfErr := this.Walk(prefix, func(relativePath string, record *ArtifactRecord) error {
+		if !isDirectoryRecord(record) {
+			artifacts[relativePath] = record.Url
+		}
+
+		return nil
+	})
+
+	if shelfErr != nil && !IsNotFound(shelfErr) {
+		return nil, shelfErr
+	}
+
+	return artifacts, nil
+}
+
+// Compares a file with the artifact at artifactUrl, if there is one.
+func (this *ShelfLib) syncEntry(relativePath string, filePath string, artifactUrl string) (*SyncEntry, *ShelfError) {
+	entry := &SyncEntry{Path: relativePath, Action: SyncUpload, FilePath: filePath}
+
+	if artifactUrl == "" {
+		return entry, nil
+	}
+
+	localHash, err := fileSha256(filePath)
+
+	if err != nil {
+		return nil, CreateShelfErrorFromError(err)
+	}
+
+	metadata, shelfErr := this.GetMetadata(artifactUrl)
+
+	if shelfErr != nil {
+		return nil, shelfErr
+	}
+
+	entry.LocalHash = localHash
+	entry.Action = SyncChanged
+
+	if prop, ok := metadata[PropertySha256Hash]; ok {
+		entry.RemoteHash = prop.Value
+	}
+
+	if entry.RemoteHash == localHash {
+		entry.Action = SyncUnchanged
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,87 @@
+package shelflib_test
+
+import (
+	"bytes"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+)
+
+var _ = Describe("Sync", func() {
+	var (
+		server *shelftest.Server
+		client *shelflib.ShelfLib
+		dir    string
+		prefix string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = ioutil.TempDir("", "sync")
+		Expect(err).ShouldNot(HaveOccurred())
+		writeFiles(dir, map[string]string{
+			"same.txt":      "same",
+			"changed.txt":   "new content",
+			"docs/new.txt":  "new",
+			"docs/skip.tmp": "skip",
+		})
+
+		server = shelftest.NewServer(validToken)
+		server.PutArtifact("test", "site/same.txt", []byte("same"))
+		server.PutArtifact("test", "site/changed.txt", []byte("old content"))
+		server.PutArtifact("test", "site/remote.txt", []byte("remote"))
+		client = server.NewShelf(validToken)
+		prefix = server.ArtifactUrl("test", "site")
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should print the plan on a dry run", func() {
+		output := new(bytes.Buffer)
+		server.ResetRequests()
+
+		report, shelfErr := client.Sync(dir, prefix, &shelflib.SyncOptions{DryRun: true, Output: output, Exclude: []string{"*.tmp"}})
+		Expect(shelfErr).To(BeNil())
+		Expect(report.DryRun).To(BeTrue())
+		Expect(output.String()).To(MatchRegexp(
+			`^changed changed.txt \(local sha256 [0-9a-f]{64}, remote [0-9a-f]{64}\)\n` +
+				`upload docs/new.txt\n` +
+				`unchanged same.txt\n$`))
+		Expect(report.RemoteOnly).To(Equal([]string{"remote.txt"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"docs/skip.tmp": "excluded"}))
+
+		for _, request := range server.Requests() {
+			Expect(request).Should(Or(HavePrefix("GET "), HavePrefix("HEAD ")))
+		}
+	})
+
+	It("should upload only new files and report changed ones", func() {
+		report, shelfErr := client.Sync(dir, prefix, &shelflib.SyncOptions{Exclude: []string{"*.tmp"}})
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"docs/new.txt"}))
+		Expect(report.Skipped).To(HaveKeyWithValue("same.txt", "unchanged"))
+		Expect(report.Failed["changed.txt"].Code).To(Equal(shelflib.CodeDuplicateArtifact))
+		Expect(report.Err()).ShouldNot(BeNil())
+
+		content, _, _ := server.Artifact("test", "site/docs/new.txt")
+		Expect(string(content)).To(Equal("new"))
+
+		report, _ = client.Sync(dir, prefix, &shelflib.SyncOptions{Exclude: []string{"*.tmp", "changed.txt"}})
+		Expect(report.Transferred).To(BeEmpty())
+		Expect(report.Err()).To(BeNil())
+	})
+
+	It("should upload everything to a new prefix", func() {
+		report, shelfErr := client.Sync(dir, server.ArtifactUrl("test", "fresh"), nil)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Transferred).To(HaveLen(4))
+		Expect(report.RemoteOnly).To(BeEmpty())
+	})
+})
@@ -0,0 +1,183 @@
+package shelflib
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variable EnvTokenSource reads by default.
+const TokenEnvVar = "SHELF_AUTH_TOKEN"
+
+// Provides the token for every request made to Shelf.
+type TokenSource interface {
+	// Token to authorize the request with.
+	Token(request *http.Request) (string, error)
+	// Called when Shelf rejects a token so that a
+	// fresh one is returned by the next call to Token.
+	Refresh() error
+}
+
+// The same token for every request.
+type StaticTokenSource string
+
+func (this StaticTokenSource) Token(request *http.Request) (string, error) {
+	return string(this), nil
+}
+
+func (this StaticTokenSource) Refresh() error {
+	return nil
+}
+
+// Reads the token from an environment variable on every request.
+type EnvTokenSource struct {
+	// Defaults to SHELF_AUTH_TOKEN.
+	Name string
+}
+
+// Create an EnvTokenSource. Uses SHELF_AUTH_TOKEN if name is empty.
+func NewEnvTokenSource(name string) *EnvTokenSource {
+	if name == "" {
+		name = TokenEnvVar
+	}
+
+	return &EnvTokenSource{Name: name}
+}
+
+func (this *EnvTokenSource) Token(request *http.Request) (string, error) {
+	name := this.Name
+
+	if name == "" {
+		name = TokenEnvVar
+	}
+
+	token := os.Getenv(name)
+
+	if token == "" {
+		return "", errors.New("Environment variable " + name + " is not set.")
+	}
+
+	return token, nil
+}
+
+func (this *EnvTokenSource) Refresh() error {
+	return nil
+}
+
+// Reads the token from a file and re-reads it whenever the file
+// changes, for example when a sidecar rotates it.
+type FileTokenSource struct {
+	Path    string
+	lock    sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Create a FileTokenSource.
+func NewFileTokenSource(path string) *FileTokenSource {
+	return &FileTokenSource{Path: path}
+}
+
+func (this *FileTokenSource) Token(request *http.Request) (string, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	info, err := os.Stat(this.Path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if this.token != "" && info.ModTime().Equal(this.modTime) && info.Size() == this.size {
+		return this.token, nil
+	}
+
+	data, err := ioutil.ReadFile(this.Path)
+
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+
+	if token == "" {
+		return "", errors.New("Token file " + this.Path + " is empty.")
+	}
+
+	this.token = token
+	this.modTime = info.ModTime()
+	this.size = info.Size()
+
+	return this.token, nil
+}
+
+// Forces the file to be read again.
+func (this *FileTokenSource) Refresh() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.token = ""
+
+	return nil
+}
+
+// Picks a TokenSource by the host and bucket of the request. Keys are
+// either "host" or "host/bucket", where the bucket is the first segment
+// of the path. The most specific key wins.
+type MapTokenSource struct {
+	Sources map[string]TokenSource
+	// Used when no key matches. Optional.
+	Default TokenSource
+}
+
+func (this *MapTokenSource) Token(request *http.Request) (string, error) {
+	source := this.sourceFor(request)
+
+	if source == nil {
+		return "", errors.New("No token configured for " + request.URL.Host + ".")
+	}
+
+	return source.Token(request)
+}
+
+func (this *MapTokenSource) Refresh() error {
+	var firstErr error
+
+	for _, source := range this.Sources {
+		err := source.Refresh()
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if this.Default != nil {
+		err := this.Default.Refresh()
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (this *MapTokenSource) sourceFor(request *http.Request) TokenSource {
+	host := request.URL.Host
+	bucket := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)[0]
+
+	if source, ok := this.Sources[host+"/"+bucket]; ok {
+		return source
+	}
+
+	if source, ok := this.Sources[host]; ok {
+		return source
+	}
+
+	return this.Default
+}
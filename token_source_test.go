@@ -0,0 +1,120 @@
+package shelflib_test
+
+import (
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hands out the next token every time it is refreshed.
+type rotatingTokenSource struct {
+	tokens    []string
+	refreshes int
+}
+
+func (this *rotatingTokenSource) Token(request *http.Request) (string, error) {
+	return this.tokens[this.refreshes], nil
+}
+
+func (this *rotatingTokenSource) Refresh() error {
+	this.refreshes++
+
+	return nil
+}
+
+var _ = Describe("TokenSource", func() {
+	var tokens []string
+
+	BeforeEach(func() {
+		tokens = []string{}
+
+		httpmock.RegisterResponder("POST", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+			body, _ := ioutil.ReadAll(request.Body)
+			tokens = append(tokens, request.Header.Get("Authorization"))
+
+			if request.Header.Get("Authorization") != validToken {
+				return httpmock.NewJsonResponse(401, map[string]string{"message": "Permission denied", "code": "permission_denied"})
+			}
+
+			Expect(string(body)).To(ContainSubstring("Simple Text File"))
+
+			return httpmock.NewStringResponse(201, ""), nil
+		})
+	})
+
+	It("should refresh and retry once when a token is rejected", func() {
+		source := &rotatingTokenSource{tokens: []string{"EXPIRED", validToken}}
+		shelf = shelflib.NewWithTokenSource(source, logger)
+		err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tokens).To(Equal([]string{"EXPIRED", validToken}))
+	})
+
+	It("should only retry once", func() {
+		source := &rotatingTokenSource{tokens: []string{"EXPIRED", "STILL-EXPIRED", validToken}}
+		shelf = shelflib.NewWithTokenSource(source, logger)
+		err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(shelflib.IsPermissionDenied(err)).To(BeTrue())
+		Expect(tokens).To(HaveLen(2))
+	})
+
+	It("should not retry when refreshing keeps the token", func() {
+		shelf = shelflib.NewWithTokenSource(shelflib.StaticTokenSource("EXPIRED"), logger)
+		err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(shelflib.IsPermissionDenied(err)).To(BeTrue())
+		Expect(tokens).To(Equal([]string{"EXPIRED"}))
+	})
+
+	It("should read the token from the environment", func() {
+		os.Setenv("SHELFLIB_TEST_TOKEN", validToken)
+		defer os.Unsetenv("SHELFLIB_TEST_TOKEN")
+		shelf = shelflib.NewWithTokenSource(shelflib.NewEnvTokenSource("SHELFLIB_TEST_TOKEN"), logger)
+		err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should fail when the environment variable is not set", func() {
+		shelf = shelflib.NewWithTokenSource(shelflib.NewEnvTokenSource("SHELFLIB_TEST_MISSING"), logger)
+		err := shelf.UploadArtifact(uriMap["artifact"], strings.NewReader("Simple Text File"))
+		Expect(err.Message).To(ContainSubstring("SHELFLIB_TEST_MISSING"))
+		Expect(tokens).To(BeEmpty())
+	})
+
+	It("should re-read a token file when it changes", func() {
+		dir, _ := ioutil.TempDir("", "shelflib-token")
+		defer os.RemoveAll(dir)
+		tokenFile := filepath.Join(dir, "token")
+		ioutil.WriteFile(tokenFile, []byte("OLD\n"), 0600)
+		source := shelflib.NewFileTokenSource(tokenFile)
+		request, _ := http.NewRequest("GET", uriMap["artifact"], nil)
+
+		Expect(source.Token(request)).To(Equal("OLD"))
+		ioutil.WriteFile(tokenFile, []byte("NEWER\n"), 0600)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(tokenFile, later, later)
+		Expect(source.Token(request)).To(Equal("NEWER"))
+	})
+
+	It("should pick tokens by host and bucket", func() {
+		source := &shelflib.MapTokenSource{
+			Sources: map[string]shelflib.TokenSource{
+				"api.shelf.cwscloud.net":      shelflib.StaticTokenSource("HOST"),
+				"api.shelf.cwscloud.net/test": shelflib.StaticTokenSource("BUCKET"),
+			},
+		}
+		request, _ := http.NewRequest("GET", uriMap["artifact"], nil)
+		Expect(source.Token(request)).To(Equal("BUCKET"))
+		request, _ = http.NewRequest("GET", host+"other/thing", nil)
+		Expect(source.Token(request)).To(Equal("HOST"))
+		request, _ = http.NewRequest("GET", "https://elsewhere/test/thing", nil)
+		_, err := source.Token(request)
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,139 @@
+package shelflib
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// Creates spans for ShelfLib operations and the requests they send.
+// Every operation gets a span named "shelf.<operation>" and every
+// attempt at sending a request a child span named "HTTP <method>".
+type Tracer interface {
+	// Starts a span that is a child of the span in ctx, if any.
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Adds headers, such as the W3C traceparent, that
+	// propagate the span in ctx to Shelf.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span created by a Tracer. Must be safe for concurrent use
+// because httptrace hooks may be called from other goroutines.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	AddEvent(name string)
+	RecordError(err error)
+	End()
+}
+
+// Tracer used when Request.Tracer is nil. Creates no spans.
+type NoopTracer struct{}
+
+func (this NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (this NoopTracer) Inject(ctx context.Context, header http.Header) {}
+
+type noopSpan struct{}
+
+func (this noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (this noopSpan) AddEvent(name string) {}
+
+func (this noopSpan) RecordError(err error) {}
+
+func (this noopSpan) End() {}
+
+// Names of the events added to request spans for httptrace phases.
+const (
+	EventDnsStart          = "dns_start"
+	EventDnsDone           = "dns_done"
+	EventConnectStart      = "connect_start"
+	EventConnectDone       = "connect_done"
+	EventTlsHandshakeStart = "tls_handshake_start"
+	EventTlsHandshakeDone  = "tls_handshake_done"
+	EventGotConn           = "got_conn"
+	EventFirstByte         = "first_byte"
+)
+
+// Records the phases of sending a request as events on span.
+func NewClientTrace(span Span) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent(EventDnsStart)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			span.AddEvent(EventDnsDone)
+
+			if info.Err != nil {
+				span.RecordError(info.Err)
+			}
+		},
+		ConnectStart: func(network string, addr string) {
+			span.AddEvent(EventConnectStart)
+		},
+		ConnectDone: func(network string, addr string, err error) {
+			span.AddEvent(EventConnectDone)
+
+			if err != nil {
+				span.RecordError(err)
+			}
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent(EventTlsHandshakeStart)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			span.AddEvent(EventTlsHandshakeDone)
+
+			if err != nil {
+				span.RecordError(err)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttribute("net.conn_reused", info.Reused)
+			span.AddEvent(EventGotConn)
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent(EventFirstByte)
+		},
+	}
+}
+
+// Sends a request in a span of its own. The request is traced
+// with httptrace and carries headers propagating the span.
+func (this *Request) traced(next Doer) Doer {
+	return DoerFunc(func(request *http.Request) (*http.Response, error) {
+		ctx, span := this.Tracer.Start(request.Context(), "HTTP "+request.Method)
+		defer span.End()
+
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.url", RedactUrl(request.URL))
+		span.SetAttribute("shelf.operation", OperationFromContext(ctx))
+		span.SetAttribute("shelf.attempt", AttemptFromContext(ctx))
+
+		request = request.WithContext(httptrace.WithClientTrace(ctx, NewClientTrace(span)))
+		this.Tracer.Inject(ctx, request.Header)
+		response, err := next.Do(request)
+
+		if err != nil {
+			span.RecordError(err)
+
+			return response, err
+		}
+
+		span.SetAttribute("http.status_code", response.StatusCode)
+
+		return response, err
+	})
+}
+
+// Tracer operations are traced with.
+func (this *Request) tracer() Tracer {
+	if this.Tracer == nil {
+		return NoopTracer{}
+	}
+
+	return this.Tracer
+}
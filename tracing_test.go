@@ -0,0 +1,109 @@
+package shelflib_test
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"sync"
+)
+
+// Records the spans started and ended, in order.
+type recordingTracer struct {
+	lock   sync.Mutex
+	events []string
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	name   string
+}
+
+func (this *recordingTracer) record(event string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.events = append(this.events, event)
+}
+
+func (this *recordingTracer) Start(ctx context.Context, name string) (context.Context, shelflib.Span) {
+	this.record("start " + name)
+
+	return ctx, &recordingSpan{tracer: this, name: name}
+}
+
+func (this *recordingTracer) Inject(ctx context.Context, header http.Header) {
+	header.Set("traceparent", "test")
+}
+
+func (this *recordingSpan) SetAttribute(key string, value interface{}) {}
+
+func (this *recordingSpan) AddEvent(name string) {}
+
+func (this *recordingSpan) RecordError(err error) {
+	this.tracer.record("error " + this.name)
+}
+
+func (this *recordingSpan) End() {
+	this.tracer.record("end " + this.name)
+}
+
+var _ = Describe("Tracer", func() {
+	var (
+		tracer      *recordingTracer
+		traceparent string
+	)
+
+	BeforeEach(func() {
+		tracer = &recordingTracer{}
+		shelf = shelflib.New(validToken, logger)
+		shelf.Request.Tracer = tracer
+
+		httpmock.RegisterResponder("GET", uriMap["meta"], func(request *http.Request) (*http.Response, error) {
+			traceparent = request.Header.Get("traceparent")
+
+			return httpmock.NewJsonResponse(200, map[string]interface{}{})
+		})
+	})
+
+	It("should start a request span inside the operation span", func() {
+		_, err := shelf.GetMetadata(uriMap["artifact"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tracer.events).To(Equal([]string{
+			"start shelf.GetMetadata",
+			"start HTTP GET",
+			"end HTTP GET",
+			"end shelf.GetMetadata",
+		}))
+	})
+
+	It("should end a download's span once its body is closed", func() {
+		httpmock.RegisterResponder("GET", uriMap["artifact"], func(request *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(200, "Simple Text File"), nil
+		})
+
+		body, err := shelf.DownloadArtifact(uriMap["artifact"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tracer.events).ShouldNot(ContainElement("end shelf.DownloadArtifact"))
+
+		(*body).Close()
+		Expect(tracer.events).To(HaveLen(4))
+		Expect(tracer.events[3]).To(Equal("end shelf.DownloadArtifact"))
+	})
+
+	It("should inject headers into requests", func() {
+		shelf.GetMetadata(uriMap["artifact"])
+		Expect(traceparent).To(Equal("test"))
+	})
+
+	It("should not trace when no tracer is set", func() {
+		shelf.Request.Tracer = nil
+		traceparent = ""
+
+		_, err := shelf.GetMetadata(uriMap["artifact"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(traceparent).To(BeEmpty())
+	})
+})
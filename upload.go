@@ -0,0 +1,103 @@
+package shelflib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Returned when an upload finds an artifact at its path with
+// different content. Compare with errors.Is.
+var ErrContentMismatch error = codeError{code: CodeContentMismatch, message: "Artifact exists with different content."}
+
+// Options for UploadArtifactOnce.
+type UploadOptions struct {
+	// Check whether the artifact exists with a HEAD request first,
+	// so that the body is not sent when it does.
+	Preflight bool
+}
+
+// Upload an artifact unless an identical one is already at path, which
+// makes reruns of a job safe. When Shelf reports a duplicate artifact
+// its sha256Hash metadata is compared with the content. Returns whether
+// the artifact was uploaded, or ErrContentMismatch if the content differs.
+func (this *ShelfLib) UploadArtifactOnce(path string, reader io.Reader, opts *UploadOptions) (bool, *ShelfError) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+
+	shelfLib, end := this.operation("UploadArtifactOnce")
+	defer end()
+
+	hash := sha256.New()
+	hashed := io.TeeReader(reader, hash)
+
+	if opts.Preflight {
+		_, shelfErr := shelfLib.ListArtifact(path)
+
+		if shelfErr == nil {
+			if _, err := io.Copy(ioutil.Discard, hashed); err != nil {
+				return false, CreateShelfErrorFromError(err)
+			}
+
+			return false, shelfLib.compareContent(path, hex.EncodeToString(hash.Sum(nil)))
+		}
+
+		if !IsNotFound(shelfErr) {
+			return false, shelfErr
+		}
+	}
+
+	shelfErr := shelfLib.UploadArtifact(path, hashed)
+
+	if shelfErr == nil || !HasCode(shelfErr, CodeDuplicateArtifact) {
+		return shelfErr == nil, shelfErr
+	}
+
+	// Whatever the upload did not read still counts for the hash.
+	if _, err := io.Copy(ioutil.Discard, hashed); err != nil {
+		return false, CreateShelfErrorFromError(err)
+	}
+
+	return false, shelfLib.compareContent(path, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// Upload an artifact from a file path unless an identical one is
+// already there. See UploadArtifactOnce.
+func (this *ShelfLib) UploadArtifactFromFileOnce(path string, filePath string, opts *UploadOptions) (bool, *ShelfError) {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		shelfErr := CreateShelfErrorFromError(err)
+
+		return false, shelfErr
+	}
+
+	defer file.Close()
+
+	return this.UploadArtifactOnce(path, file, opts)
+}
+
+// Nil if the artifact at path has the sha256 localHash,
+// otherwise an error matching ErrContentMismatch.
+func (this *ShelfLib) compareContent(path string, localHash string) *ShelfError {
+	metadata, shelfErr := this.GetMetadata(path)
+
+	if shelfErr != nil {
+		return shelfErr
+	}
+
+	prop, ok := metadata[PropertySha256Hash]
+
+	if !ok {
+		return CreateShelfError("Artifact "+path+" exists and has no "+PropertySha256Hash+" to compare with.", CodeContentMismatch)
+	}
+
+	if prop.Value != localHash {
+		return CreateShelfError("Artifact "+path+" exists with sha256 "+prop.Value+", not "+localHash+".", CodeContentMismatch)
+	}
+
+	return nil
+}
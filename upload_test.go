@@ -0,0 +1,104 @@
+package shelflib_test
+
+import (
+	"errors"
+	"github.com/not-nexus/shelf-lib-go"
+	"github.com/not-nexus/shelf-lib-go/shelftest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var _ = Describe("UploadArtifactOnce", func() {
+	var (
+		server      *shelftest.Server
+		client      *shelflib.ShelfLib
+		artifactUrl string
+	)
+
+	BeforeEach(func() {
+		server = shelftest.NewServer(validToken)
+		server.PutArtifact("test", "builds/app.tar.gz", []byte("app"))
+		client = server.NewShelf(validToken)
+		artifactUrl = server.ArtifactUrl("test", "builds/app.tar.gz")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload new artifacts", func() {
+		uploaded, shelfErr := client.UploadArtifactOnce(server.ArtifactUrl("test", "builds/new"), strings.NewReader("new"), nil)
+		Expect(shelfErr).To(BeNil())
+		Expect(uploaded).To(BeTrue())
+
+		content, _, _ := server.Artifact("test", "builds/new")
+		Expect(string(content)).To(Equal("new"))
+	})
+
+	It("should succeed when an identical artifact exists", func() {
+		uploaded, shelfErr := client.UploadArtifactOnce(artifactUrl, strings.NewReader("app"), nil)
+		Expect(shelfErr).To(BeNil())
+		Expect(uploaded).To(BeFalse())
+	})
+
+	It("should fail when the content differs", func() {
+		uploaded, shelfErr := client.UploadArtifactOnce(artifactUrl, strings.NewReader("other"), nil)
+		Expect(uploaded).To(BeFalse())
+		Expect(errors.Is(shelfErr, shelflib.ErrContentMismatch)).To(BeTrue())
+	})
+
+	It("should not send the body when the preflight finds the artifact", func() {
+		server.ResetRequests()
+
+		uploaded, shelfErr := client.UploadArtifactOnce(artifactUrl, strings.NewReader("app"), &shelflib.UploadOptions{Preflight: true})
+		Expect(shelfErr).To(BeNil())
+		Expect(uploaded).To(BeFalse())
+		Expect(server.Requests()).To(Equal([]string{"HEAD /test/artifact/builds/app.tar.gz", "GET /test/artifact/builds/app.tar.gz/_meta"}))
+
+		uploaded, shelfErr = client.UploadArtifactOnce(server.ArtifactUrl("test", "builds/new"), strings.NewReader("new"), &shelflib.UploadOptions{Preflight: true})
+		Expect(shelfErr).To(BeNil())
+		Expect(uploaded).To(BeTrue())
+	})
+
+	It("should skip identical files in UploadDirectory", func() {
+		dir, err := ioutil.TempDir("", "upload")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		writeFiles(dir, map[string]string{"app.tar.gz": "app", "new": "new"})
+
+		report, shelfErr := client.UploadDirectory(dir, server.ArtifactUrl("test", "builds"), &shelflib.UploadDirectoryOptions{SkipIdentical: true})
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Err()).To(BeNil())
+		Expect(report.Transferred).To(Equal([]string{"new"}))
+		Expect(report.Skipped).To(Equal(map[string]string{"app.tar.gz": "identical"}))
+	})
+
+	It("should apply metadata to identical files in UploadDirectory", func() {
+		dir, err := ioutil.TempDir("", "upload")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		writeFiles(dir, map[string]string{"app.tar.gz": "app"})
+		server.SetMetadata("test", "builds/app.tar.gz", shelflib.CreateMetadataProperty("version", "1.2", true))
+
+		opts := &shelflib.UploadDirectoryOptions{
+			SkipIdentical: true,
+			Metadata: func(relativePath string, filePath string) map[string]*shelflib.MetadataProperty {
+				return map[string]*shelflib.MetadataProperty{
+					"version": shelflib.CreateMetadataProperty("version", "1.2", true),
+					"status":  shelflib.CreateMetadataProperty("status", "built", false),
+				}
+			},
+		}
+
+		report, shelfErr := client.UploadDirectory(dir, server.ArtifactUrl("test", "builds"), opts)
+		Expect(shelfErr).To(BeNil())
+		Expect(report.Err()).To(BeNil())
+		Expect(report.Skipped).To(Equal(map[string]string{"app.tar.gz": "identical"}))
+
+		_, metadata, _ := server.Artifact("test", "builds/app.tar.gz")
+		Expect(metadata["status"].Value).To(Equal("built"))
+	})
+})
@@ -0,0 +1,329 @@
+package shelflib
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/tomnomnom/linkheader"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type WatchEventType string
+
+// Interval a Watcher polls at when its Interval is not positive.
+const DefaultWatchInterval = time.Minute
+
+const (
+	WatchAdded           WatchEventType = "added"
+	WatchRemoved         WatchEventType = "removed"
+	WatchMetadataChanged WatchEventType = "metadata_changed"
+	WatchFailed          WatchEventType = "error"
+)
+
+// Emitted by a Watcher when the results of its search change.
+type WatchEvent struct {
+	Type WatchEventType
+	// Absolute URL of the artifact.
+	Path string
+	Link linkheader.Link
+	// Current and previous metadata snapshots. Only populated
+	// when the Watcher is tracking metadata.
+	Metadata         map[string]*MetadataProperty
+	PreviousMetadata map[string]*MetadataProperty
+	// Set for WatchFailed events.
+	Err *ShelfError
+}
+
+// Re-runs a search on an interval and emits events for
+// artifacts that appear, disappear or have their metadata changed.
+type Watcher struct {
+	// Requests are made with the context the Watcher is started
+	// with when this is a *ShelfLib.
+	Shelf    ShelfClient
+	Path     string
+	Criteria *SearchCriteria
+	// Defaults to DefaultWatchInterval if not positive.
+	Interval time.Duration
+	// Compare metadata snapshots between polls.
+	WatchMetadata bool
+	// File the seen set is persisted to so that a restarted
+	// Watcher does not replay events. Not persisted if empty.
+	StateFile string
+}
+
+// Seen set as it is persisted to the state file.
+type watchState struct {
+	Seen map[string]map[string]*MetadataProperty `json:"seen"`
+}
+
+// Create a Watcher for a search.
+func (this *ShelfLib) NewWatcher(path string, criteria *SearchCriteria, interval time.Duration) *Watcher {
+	if criteria == nil {
+		criteria = &SearchCriteria{}
+	}
+
+	return &Watcher{Shelf: this, Path: path, Criteria: criteria, Interval: interval}
+}
+
+// Watch a search for added and removed artifacts.
+// The channel is closed once the context is done.
+func (this *ShelfLib) Watch(ctx context.Context, path string, criteria *SearchCriteria, interval time.Duration) <-chan *WatchEvent {
+	return this.NewWatcher(path, criteria, interval).Start(ctx)
+}
+
+// Starts polling. The first poll happens immediately.
+// The channel is closed once the context is done.
+func (this *Watcher) Start(ctx context.Context) <-chan *WatchEvent {
+	events := make(chan *WatchEvent)
+
+	go this.run(ctx, events)
+
+	return events
+}
+
+func (this *Watcher) run(ctx context.Context, events chan *WatchEvent) {
+	defer close(events)
+
+	seen, err := this.loadState()
+
+	if err != nil {
+		this.send(ctx, events, &WatchEvent{Type: WatchFailed, Path: this.Path, Err: err})
+		seen = make(map[string]map[string]*MetadataProperty)
+	}
+
+	interval := this.Interval
+
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		seen = this.poll(ctx, seen, events)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs the search once, emits events for any differences with
+// the seen set and returns the new seen set.
+func (this *Watcher) poll(ctx context.Context, seen map[string]map[string]*MetadataProperty, events chan *WatchEvent) map[string]map[string]*MetadataProperty {
+	shelf := this.client(ctx)
+	links, err := shelf.Search(this.Path, this.Criteria)
+
+	if err != nil {
+		this.send(ctx, events, &WatchEvent{Type: WatchFailed, Path: this.Path, Err: err})
+
+		return seen
+	}
+
+	changed := false
+	current := make(map[string]map[string]*MetadataProperty)
+
+	for _, link := range *links {
+		artifactPath, err := ResolveLinkUrl(this.Path, link)
+
+		if err != nil {
+			this.send(ctx, events, &WatchEvent{Type: WatchFailed, Path: link.URL, Link: link, Err: err})
+
+			continue
+		}
+
+		previous, ok := seen[artifactPath]
+		var metadata map[string]*MetadataProperty
+
+		if this.WatchMetadata {
+			metadata, err = shelf.GetMetadata(artifactPath)
+
+			if err != nil {
+				this.send(ctx, events, &WatchEvent{Type: WatchFailed, Path: artifactPath, Link: link, Err: err})
+
+				// Keep the last snapshot so that the artifact is not
+				// reported as removed. New artifacts are picked up
+				// on the next poll.
+				if ok {
+					current[artifactPath] = previous
+				}
+
+				continue
+			}
+		}
+
+		current[artifactPath] = metadata
+		event := &WatchEvent{Path: artifactPath, Link: link, Metadata: metadata, PreviousMetadata: previous}
+
+		if !ok {
+			event.Type = WatchAdded
+		} else if this.WatchMetadata && !metadataEqual(previous, metadata) {
+			event.Type = WatchMetadataChanged
+		} else {
+			continue
+		}
+
+		changed = true
+
+		if !this.send(ctx, events, event) {
+			return seen
+		}
+	}
+
+	removed := make([]string, 0)
+
+	for artifactPath := range seen {
+		if _, ok := current[artifactPath]; !ok {
+			removed = append(removed, artifactPath)
+		}
+	}
+
+	sort.Strings(removed)
+
+	for _, artifactPath := range removed {
+		changed = true
+		event := &WatchEvent{Type: WatchRemoved, Path: artifactPath, PreviousMetadata: seen[artifactPath]}
+
+		if !this.send(ctx, events, event) {
+			return seen
+		}
+	}
+
+	if changed {
+		err = this.saveState(current)
+
+		if err != nil {
+			this.send(ctx, events, &WatchEvent{Type: WatchFailed, Path: this.StateFile, Err: err})
+		}
+	}
+
+	return current
+}
+
+// Client that makes its requests with ctx, so that
+// stopping the Watcher cancels a poll in flight.
+func (this *Watcher) client(ctx context.Context) ShelfClient {
+	if shelfLib, ok := this.Shelf.(*ShelfLib); ok {
+		return shelfLib.WithContext(ctx)
+	}
+
+	return this.Shelf
+}
+
+// Sends an event unless the context is done first.
+func (this *Watcher) send(ctx context.Context, events chan *WatchEvent, event *WatchEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Loads the seen set from the state file. A missing
+// state file is an empty seen set.
+func (this *Watcher) loadState() (map[string]map[string]*MetadataProperty, *ShelfError) {
+	var (
+		shelfErr *ShelfError
+		state    watchState
+	)
+
+	seen := make(map[string]map[string]*MetadataProperty)
+
+	if this.StateFile == "" {
+		return seen, shelfErr
+	}
+
+	data, err := ioutil.ReadFile(this.StateFile)
+
+	if os.IsNotExist(err) {
+		return seen, shelfErr
+	}
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return seen, shelfErr
+	}
+
+	err = json.Unmarshal(data, &state)
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return seen, shelfErr
+	}
+
+	if state.Seen != nil {
+		seen = state.Seen
+	}
+
+	return seen, shelfErr
+}
+
+// Writes the seen set to the state file, replacing it atomically.
+func (this *Watcher) saveState(seen map[string]map[string]*MetadataProperty) *ShelfError {
+	var shelfErr *ShelfError
+
+	if this.StateFile == "" {
+		return shelfErr
+	}
+
+	data, err := json.Marshal(&watchState{Seen: seen})
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return shelfErr
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(this.StateFile), filepath.Base(this.StateFile)+".tmp")
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+
+		return shelfErr
+	}
+
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+
+	if err == nil {
+		err = tmpFile.Close()
+	} else {
+		tmpFile.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), this.StateFile)
+	}
+
+	if err != nil {
+		shelfErr = CreateShelfErrorFromError(err)
+	}
+
+	return shelfErr
+}
+
+// Compares two metadata snapshots.
+func metadataEqual(a map[string]*MetadataProperty, b map[string]*MetadataProperty) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, prop := range a {
+		other, ok := b[key]
+
+		if !ok || other.Value != prop.Value || other.Immutable != prop.Immutable {
+			return false
+		}
+	}
+
+	return true
+}
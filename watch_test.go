@@ -0,0 +1,153 @@
+package shelflib_test
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/not-nexus/shelf-lib-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Watch", func() {
+	var (
+		searchResults  [][]string
+		metadataValues []string
+		polls          int
+		metaPolls      int
+		watchUri       = buildUri(testBucket, "watched", "artifact", "")
+		artifactA      = host + "test/artifact/watched/a"
+		artifactB      = host + "test/artifact/watched/b"
+	)
+
+	link := func(name string) string {
+		return `</test/artifact/watched/` + name + `>; rel="item"; title="artifact"`
+	}
+
+	BeforeEach(func() {
+		shelf = shelflib.New(validToken, logger)
+		polls = 0
+		metaPolls = 0
+		searchResults = [][]string{{link("a")}}
+		metadataValues = []string{"1"}
+
+		httpmock.RegisterResponder("POST", buildUri(testBucket, "watched", "search", ""), func(request *http.Request) (*http.Response, error) {
+			response := httpmock.NewStringResponse(204, "")
+			response.Header["Link"] = searchResults[polls]
+			assertRequest(request)
+
+			if polls < len(searchResults)-1 {
+				polls++
+			}
+
+			return response, nil
+		})
+
+		httpmock.RegisterResponder("GET", artifactA+"/_meta", func(request *http.Request) (*http.Response, error) {
+			value := metadataValues[metaPolls]
+
+			if metaPolls < len(metadataValues)-1 {
+				metaPolls++
+			}
+
+			return httpmock.NewJsonResponse(200, map[string]interface{}{
+				"version": map[string]interface{}{"value": value, "immutable": false},
+			})
+		})
+	})
+
+	It("should emit added and removed events", func() {
+		searchResults = [][]string{{link("a")}, {link("a"), link("b")}, {link("b")}}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := shelf.Watch(ctx, watchUri, nil, time.Millisecond)
+
+		event := <-events
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactA))
+		event = <-events
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactB))
+		event = <-events
+		Expect(event.Type).To(Equal(shelflib.WatchRemoved))
+		Expect(event.Path).To(Equal(artifactA))
+	})
+
+	It("should poll at the default interval when none is given", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := shelf.Watch(ctx, watchUri, nil, 0)
+
+		event := <-events
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactA))
+	})
+
+	It("should cancel a poll in flight when stopped", func() {
+		blockedUri := buildUri(testBucket, "blocked", "artifact", "")
+		httpmock.RegisterResponder("POST", buildUri(testBucket, "blocked", "search", ""), func(request *http.Request) (*http.Response, error) {
+			select {
+			case <-request.Context().Done():
+				return nil, request.Context().Err()
+			case <-time.After(5 * time.Second):
+				return httpmock.NewStringResponse(204, ""), nil
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events := shelf.Watch(ctx, blockedUri, nil, time.Hour)
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		Eventually(events).Should(BeClosed())
+	})
+
+	It("should emit metadata changed events", func() {
+		metadataValues = []string{"1", "1", "2"}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		watcher := shelf.NewWatcher(watchUri, nil, time.Millisecond)
+		watcher.WatchMetadata = true
+		events := watcher.Start(ctx)
+
+		event := <-events
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Metadata["version"].Value).To(Equal("1"))
+		event = <-events
+		Expect(event.Type).To(Equal(shelflib.WatchMetadataChanged))
+		Expect(event.PreviousMetadata["version"].Value).To(Equal("1"))
+		Expect(event.Metadata["version"].Value).To(Equal("2"))
+	})
+
+	It("should not replay events after a restart", func() {
+		dir, _ := ioutil.TempDir("", "shelflib-watch")
+		defer os.RemoveAll(dir)
+		stateFile := filepath.Join(dir, "state.json")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		watcher := shelf.NewWatcher(watchUri, nil, time.Hour)
+		watcher.StateFile = stateFile
+		event := <-watcher.Start(ctx)
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactA))
+		cancel()
+		Eventually(func() error {
+			_, err := os.Stat(stateFile)
+
+			return err
+		}).ShouldNot(HaveOccurred())
+
+		searchResults = [][]string{{link("a"), link("b")}}
+		polls = 0
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		watcher = shelf.NewWatcher(watchUri, nil, time.Hour)
+		watcher.StateFile = stateFile
+		event = <-watcher.Start(ctx)
+		Expect(event.Type).To(Equal(shelflib.WatchAdded))
+		Expect(event.Path).To(Equal(artifactB))
+	})
+})